@@ -17,6 +17,7 @@
 package gamepad
 
 import (
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -29,6 +30,8 @@ const (
 	_ABS_RX    = 0x03
 	_ABS_RY    = 0x04
 	_ABS_RZ    = 0x05
+	_ABS_GAS   = 0x09
+	_ABS_BRAKE = 0x0a
 	_ABS_HAT0X = 0x10
 	_ABS_HAT0Y = 0x11
 	_ABS_HAT1X = 0x12
@@ -40,13 +43,16 @@ const (
 	_ABS_CNT   = _ABS_MAX + 1
 
 	_BTN_MISC       = 0x100
+	_BTN_JOYSTICK   = 0x120
 	_BTN_GAMEPAD    = 0x130
 	_BTN_A          = 0x130
 	_BTN_B          = 0x131
+	_BTN_C          = 0x132
 	_BTN_NORTH      = 0x133
 	_BTN_X          = 0x133
 	_BTN_WEST       = 0x134
 	_BTN_Y          = 0x134
+	_BTN_Z          = 0x135
 	_BTN_TL         = 0x136
 	_BTN_TR         = 0x137
 	_BTN_TL2        = 0x138
@@ -61,6 +67,22 @@ const (
 	_BTN_DPAD_LEFT  = 0x222
 	_BTN_DPAD_RIGHT = 0x223
 
+	_BTN_TOOL_PEN    = 0x140
+	_BTN_TOOL_FINGER = 0x145
+	_BTN_STYLUS      = 0x14b
+
+	_FF_RUMBLE   = 0x50
+	_FF_PERIODIC = 0x51
+	_FF_CONSTANT = 0x52
+	_FF_SPRING   = 0x53
+	_FF_FRICTION = 0x54
+	_FF_DAMPER   = 0x55
+	_FF_INERTIA  = 0x56
+	_FF_RAMP     = 0x57
+	_FF_GAIN     = 0x60
+	_FF_MAX      = 0x7f
+	_FF_CNT      = _FF_MAX + 1
+
 	_IOC_NONE  = 0
 	_IOC_WRITE = 1
 	_IOC_READ  = 2
@@ -90,6 +112,10 @@ func _IOR(typ, nr, size uint) uint {
 	return _IOC(_IOC_READ, typ, nr, size)
 }
 
+func _IOW(typ, nr, size uint) uint {
+	return _IOC(_IOC_WRITE, typ, nr, size)
+}
+
 func _EVIOCGABS(abs uint) uint {
 	return _IOR('E', 0x40+abs, uint(unsafe.Sizeof(input_absinfo{})))
 }
@@ -106,6 +132,58 @@ func _EVIOCGNAME(len uint) uint {
 	return _IOC(_IOC_READ, 'E', 0x06, len)
 }
 
+func _EVIOCSCLOCKID() uint {
+	return _IOW('E', 0xa0, uint(unsafe.Sizeof(int32(0))))
+}
+
+func _EVIOCSFF() uint {
+	return _IOW('E', 0x80, uint(unsafe.Sizeof(ff_effect{})))
+}
+
+type ff_effect struct {
+	typ       uint16
+	id        int16
+	direction uint16
+	trigger   ff_trigger
+	replay    ff_replay
+
+	// u is a union in C. ff_periodic_effect is the largest member and determines the size and the alignment.
+	u ff_periodic_effect
+}
+
+type ff_envelope struct {
+	attack_length uint16
+	attack_level  uint16
+	fade_length   uint16
+	fade_level    uint16
+}
+
+type ff_periodic_effect struct {
+	waveform    uint16
+	period      uint16
+	magnitude   int16
+	offset      int16
+	phase       uint16
+	envelope    ff_envelope
+	custom_len  uint32
+	custom_data uintptr
+}
+
+type ff_replay struct {
+	length uint16
+	delay  uint16
+}
+
+type ff_rumble_effect struct {
+	strong_magnitude uint16
+	weak_magnitude   uint16
+}
+
+type ff_trigger struct {
+	button   uint16
+	interval uint16
+}
+
 type input_absinfo struct {
 	value      int32
 	minimum    int32
@@ -122,6 +200,10 @@ type input_event struct {
 	value int32
 }
 
+func (e *input_event) timestamp() time.Duration {
+	return time.Duration(e.time.Nano())
+}
+
 type input_id struct {
 	bustype uint16
 	vendor  uint16
@@ -129,10 +211,11 @@ type input_id struct {
 	version uint16
 }
 
+// ioctl calls the ioctl system call.
+// The first return value of unix.Syscall is an unsigned integer and is never negative, so a failure must be detected by the error number.
 func ioctl(fd int, request uint, ptr unsafe.Pointer) error {
-	r, _, e := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(request), uintptr(ptr))
-	if r < 0 {
-		return unix.Errno(e)
+	if _, _, e := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(request), uintptr(ptr)); e != 0 {
+		return e
 	}
 	return nil
 }
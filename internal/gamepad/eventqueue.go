@@ -0,0 +1,120 @@
+// Copyright 2022 The Ebiten Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gamepad
+
+// EventType represents the type of an Event.
+type EventType int
+
+const (
+	EventTypeButton EventType = iota
+	EventTypeAxis
+)
+
+// Event is a change of a button or an axis detected at an update.
+type Event struct {
+	Type EventType
+
+	// Index is the button index or the axis index.
+	Index int
+
+	// Value is 1 for a pressed button, 0 for a released button, or the new value of an axis.
+	Value float64
+}
+
+// EventQueueOverflowPolicy represents what to do when an event queue is full.
+type EventQueueOverflowPolicy int
+
+const (
+	// EventQueueDropOldest drops the oldest event to make room for a new event.
+	EventQueueDropOldest EventQueueOverflowPolicy = iota
+
+	// EventQueueDropNewest drops a new event.
+	EventQueueDropNewest
+)
+
+// eventQueue is a bounded queue of the changes of the inputs.
+type eventQueue struct {
+	capacity int
+	policy   EventQueueOverflowPolicy
+	events   []Event
+
+	// buttons and axes are the states at the last update to detect changes.
+	buttons []bool
+	axes    []float64
+}
+
+func newEventQueue(capacity int, policy EventQueueOverflowPolicy, native nativeGamepad) *eventQueue {
+	q := &eventQueue{
+		capacity: capacity,
+		policy:   policy,
+	}
+	q.snapshot(native)
+	return q
+}
+
+func (q *eventQueue) snapshot(native nativeGamepad) {
+	q.buttons = q.buttons[:0]
+	for i := 0; i < native.buttonCount(); i++ {
+		q.buttons = append(q.buttons, native.isButtonPressed(i))
+	}
+	q.axes = q.axes[:0]
+	for i := 0; i < native.axisCount(); i++ {
+		q.axes = append(q.axes, native.axisValue(i))
+	}
+}
+
+// detect enqueues the changes since the last call.
+func (q *eventQueue) detect(native nativeGamepad) {
+	for i := 0; i < native.buttonCount() && i < len(q.buttons); i++ {
+		pressed := native.isButtonPressed(i)
+		if pressed == q.buttons[i] {
+			continue
+		}
+		var v float64
+		if pressed {
+			v = 1
+		}
+		q.push(Event{Type: EventTypeButton, Index: i, Value: v})
+	}
+	for i := 0; i < native.axisCount() && i < len(q.axes); i++ {
+		v := native.axisValue(i)
+		if v == q.axes[i] {
+			continue
+		}
+		q.push(Event{Type: EventTypeAxis, Index: i, Value: v})
+	}
+	q.snapshot(native)
+}
+
+func (q *eventQueue) push(e Event) {
+	if len(q.events) >= q.capacity {
+		if q.policy == EventQueueDropNewest {
+			return
+		}
+		copy(q.events, q.events[1:])
+		q.events = q.events[:len(q.events)-1]
+	}
+	q.events = append(q.events, e)
+}
+
+func (q *eventQueue) pop() (Event, bool) {
+	if len(q.events) == 0 {
+		return Event{}, false
+	}
+	e := q.events[0]
+	copy(q.events, q.events[1:])
+	q.events = q.events[:len(q.events)-1]
+	return e, true
+}
@@ -0,0 +1,539 @@
+// Copyright 2022 The Ebiten Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !android && !nintendosdk
+
+package gamepad
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+type DeviceForTesting struct {
+	Name    string
+	BusType uint16
+	Vendor  uint16
+	Product uint16
+	Version uint16
+	Keys    []int
+	Abs     []int
+	AbsInfo map[int][2]int32
+	FF      []int
+
+	// AbsResolution is the resolutions of the abs codes.
+	AbsResolution map[int]int32
+
+	// UnreadableAbs is the abs codes for which reading the information fails.
+	UnreadableAbs []int
+
+	// EventTypes is the event types the device reports. nil means EV_KEY and EV_ABS, and EV_FF if FF is not empty.
+	// Querying the codes of an event type that is not reported fails.
+	EventTypes []int
+}
+
+func (d *DeviceForTesting) eventTypes() []int {
+	if d.EventTypes != nil {
+		return d.EventTypes
+	}
+	types := []int{unix.EV_KEY, unix.EV_ABS}
+	if len(d.FF) > 0 {
+		types = append(types, unix.EV_FF)
+	}
+	return types
+}
+
+func (d *DeviceForTesting) hasEventType(typ int) bool {
+	for _, t := range d.eventTypes() {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// ioctl emulates the ioctl of the device file.
+func (d *DeviceForTesting) ioctl(request uint, ptr unsafe.Pointer) error {
+	nr := request >> _IOC_NRSHIFT & (1<<_IOC_NRBITS - 1)
+	size := request >> _IOC_SIZESHIFT & (1<<_IOC_SIZEBITS - 1)
+	switch {
+	case nr == 0x02: // EVIOCGID
+		*(*input_id)(ptr) = input_id{
+			bustype: d.BusType,
+			vendor:  d.Vendor,
+			product: d.Product,
+			version: d.Version,
+		}
+	case nr == 0x06: // EVIOCGNAME
+		buf := unsafe.Slice((*byte)(ptr), size)
+		copy(buf[:len(buf)-1], d.Name)
+	case nr >= 0x20 && nr < 0x40: // EVIOCGBIT
+		typ := int(nr - 0x20)
+		if typ != 0 && !d.hasEventType(typ) {
+			return unix.EINVAL
+		}
+		var codes []int
+		switch typ {
+		case 0:
+			codes = d.eventTypes()
+		case unix.EV_KEY:
+			codes = d.Keys
+		case unix.EV_ABS:
+			codes = d.Abs
+		case unix.EV_FF:
+			codes = d.FF
+		}
+		buf := unsafe.Slice((*byte)(ptr), size)
+		for _, code := range codes {
+			buf[code/8] |= 1 << (code % 8)
+		}
+	case nr >= 0x40 && nr < 0x40+_ABS_CNT: // EVIOCGABS
+		if !d.hasEventType(unix.EV_ABS) {
+			return unix.EINVAL
+		}
+		code := int(nr - 0x40)
+		for _, c := range d.UnreadableAbs {
+			if c == code {
+				return unix.EIO
+			}
+		}
+		*(*input_absinfo)(ptr) = input_absinfo{
+			minimum:    d.AbsInfo[code][0],
+			maximum:    d.AbsInfo[code][1],
+			resolution: d.AbsResolution[code],
+		}
+	case nr == 0x80: // EVIOCSFF
+		if e := (*ff_effect)(ptr); e.id < 0 {
+			e.id = 0
+		}
+	case nr == 0xa0: // EVIOCSCLOCKID
+	default:
+		return unix.ENOTTY
+	}
+	return nil
+}
+
+// NewGamepadForTesting creates a gamepad that is not backed by any device file.
+// The gamepad is built by openGamepad from the emulated device.
+// Non-gamepad devices are allowed so that any device can be a fixture. Use GamepadsForTesting to test which devices are accepted.
+func NewGamepadForTesting(device *DeviceForTesting) *Gamepad {
+	fd, err := unix.Open("/dev/null", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = unix.Close(fd)
+	}()
+
+	const path = "/dev/input/event-for-testing"
+
+	g := NewGamepadsForTesting()
+	g.SetDevice(path, device, fd)
+	n := g.gamepads.native.(*nativeGamepadsImpl)
+	n.setNonGamepadDevicesAllowed(true)
+	if err := n.openGamepad(&g.gamepads, path); err != nil {
+		panic(err)
+	}
+	if len(g.gamepads.gamepads) == 0 {
+		panic("gamepad: the device for testing is not accepted")
+	}
+
+	gp := g.gamepads.gamepads[0]
+	native := gp.native.(*nativeGamepadImpl)
+	_ = unix.Close(native.fd)
+	native.fd = 0
+	return gp
+}
+
+func (g *Gamepad) HandleEventForTesting(typ, code uint16, value int32) error {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	return g.native.(*nativeGamepadImpl).handleEvent(input_event{
+		typ:   typ,
+		code:  code,
+		value: value,
+	})
+}
+
+// DetectEventsForTesting enqueues the input changes as if the gamepad were updated.
+func (g *Gamepad) DetectEventsForTesting() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.eventQueue != nil {
+		g.eventQueue.detect(g.native)
+	}
+}
+
+func (g *Gamepad) RumbleMagnitudesForTesting(strongMagnitude, weakMagnitude float64) (strong, weak uint16) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	return g.native.(*nativeGamepadImpl).rumbleMagnitudes(strongMagnitude, weakMagnitude)
+}
+
+func (g *Gamepad) FlushAbsEventsForTesting() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.native.(*nativeGamepadImpl).flushAbsEvents()
+}
+
+// StartVibrationTimerForTesting starts the timer of a vibration without a device.
+func (g *Gamepad) StartVibrationTimerForTesting(duration time.Duration) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	n := g.native.(*nativeGamepadImpl)
+	n.ffM.Lock()
+	defer n.ffM.Unlock()
+
+	n.startVibrationTimer(duration)
+}
+
+// SetFFEffectIDForTesting sets the ID of the uploaded force-feedback effect.
+func (g *Gamepad) SetFFEffectIDForTesting(id int16) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	n := g.native.(*nativeGamepadImpl)
+	n.ffM.Lock()
+	defer n.ffM.Unlock()
+
+	n.ffEffectID = id
+}
+
+// DisconnectForTesting closes the device file as if the device was disconnected.
+func (g *Gamepad) DisconnectForTesting() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.native.(*nativeGamepadImpl).close()
+}
+
+func (g *Gamepad) RecordReadForTesting(t time.Time) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.native.(*nativeGamepadImpl).readTimes.record(t)
+}
+
+type GamepadsForTesting struct {
+	gamepads gamepads
+
+	// devices is the emulated devices and the file descriptors to read their events, keyed by their paths.
+	devices map[string]deviceFileForTesting
+
+	// openedDevices is the emulated devices keyed by the file descriptors opened for them.
+	openedDevices map[int]*DeviceForTesting
+}
+
+type deviceFileForTesting struct {
+	device *DeviceForTesting
+	fd     int
+}
+
+func NewGamepadsForTesting() *GamepadsForTesting {
+	g := &GamepadsForTesting{}
+	g.gamepads.native = &nativeGamepadsImpl{
+		open:  g.open,
+		ioctl: g.ioctl,
+	}
+	return g
+}
+
+// SetDevice emulates the device at path. Opening path duplicates fd, from which the events are read.
+func (g *GamepadsForTesting) SetDevice(path string, device *DeviceForTesting, fd int) {
+	if g.devices == nil {
+		g.devices = map[string]deviceFileForTesting{}
+	}
+	g.devices[path] = deviceFileForTesting{
+		device: device,
+		fd:     fd,
+	}
+}
+
+// RemoveDevice stops emulating the device at path.
+func (g *GamepadsForTesting) RemoveDevice(path string) {
+	delete(g.devices, path)
+}
+
+func (g *GamepadsForTesting) open(path string, mode int) (int, error) {
+	f, ok := g.devices[path]
+	if !ok {
+		return unix.Open(path, mode, 0)
+	}
+	fd, err := unix.FcntlInt(uintptr(f.fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return 0, err
+	}
+	if g.openedDevices == nil {
+		g.openedDevices = map[int]*DeviceForTesting{}
+	}
+	g.openedDevices[fd] = f.device
+	return fd, nil
+}
+
+func (g *GamepadsForTesting) ioctl(fd int, request uint, ptr unsafe.Pointer) error {
+	d, ok := g.openedDevices[fd]
+	if !ok {
+		return ioctl(fd, request, ptr)
+	}
+	return d.ioctl(request, ptr)
+}
+
+func (g *GamepadsForTesting) SetDirNames(dirNames []string) {
+	g.gamepads.native.(*nativeGamepadsImpl).setDirNames(dirNames)
+}
+
+// SetWatchMask sets the inotify events to watch. This must be called before Init.
+func (g *GamepadsForTesting) SetWatchMask(mask uint32) {
+	g.gamepads.native.(*nativeGamepadsImpl).watchMask = mask
+}
+
+func (g *GamepadsForTesting) Init() error {
+	if err := g.gamepads.native.init(&g.gamepads); err != nil {
+		return err
+	}
+	g.gamepads.inited = true
+	return nil
+}
+
+func (g *GamepadsForTesting) Update() error {
+	return g.gamepads.update()
+}
+
+func (g *GamepadsForTesting) SetErrorHandler(handler func(err error)) {
+	g.gamepads.setErrorHandler(handler)
+}
+
+func (g *GamepadsForTesting) Close() error {
+	if n := g.gamepads.native.(*nativeGamepadsImpl); n.inotify > 0 {
+		return unix.Close(n.inotify)
+	}
+	return nil
+}
+
+func (g *GamepadsForTesting) OpenGamepad(path string, now time.Time) error {
+	return g.gamepads.native.(*nativeGamepadsImpl).openGamepadWithBackoff(&g.gamepads, path, now)
+}
+
+// SetClock replaces the clock for the gamepads. This must be called before any gamepads are added.
+func (g *GamepadsForTesting) SetClock(clock *FakeClockForTesting) {
+	g.gamepads.clock = clock
+}
+
+// AddGamepad adds a gamepad reading events from the given file descriptor.
+func (g *GamepadsForTesting) AddGamepad(device *DeviceForTesting, fd int) *Gamepad {
+	gp := NewGamepadForTesting(device)
+	gp.native.(*nativeGamepadImpl).fd = fd
+	gp.native.(*nativeGamepadImpl).clock = g.gamepads.getClock()
+	g.gamepads.gamepads = append(g.gamepads.gamepads, gp)
+	return gp
+}
+
+// Gamepads returns the added gamepads.
+func (g *GamepadsForTesting) Gamepads() []*Gamepad {
+	var gps []*Gamepad
+	for _, gp := range g.gamepads.gamepads {
+		if gp == nil {
+			continue
+		}
+		gps = append(gps, gp)
+	}
+	return gps
+}
+
+// GamepadByPath returns the gamepad for the device at path, or nil if there is no such gamepad.
+func (g *GamepadsForTesting) GamepadByPath(path string) *Gamepad {
+	return g.gamepads.find(func(gamepad *Gamepad) bool {
+		return gamepad.native.(*nativeGamepadImpl).path == path
+	})
+}
+
+// RemoveGamepad removes the gamepad as if it were disconnected.
+func (g *GamepadsForTesting) RemoveGamepad(gp *Gamepad) {
+	g.gamepads.remove(func(gamepad *Gamepad) bool {
+		return gamepad == gp
+	})
+}
+
+func (g *GamepadsForTesting) InputState() *InputState {
+	return g.gamepads.inputState()
+}
+
+// HandleInotifyEvents handles the bytes as if they were read from the inotify instance.
+func (g *GamepadsForTesting) HandleInotifyEvents(buf []byte) {
+	n := g.gamepads.native.(*nativeGamepadsImpl)
+	n.inotifyBuf = append(n.inotifyBuf, buf...)
+	rest := n.handleInotifyEvents(&g.gamepads, n.inotifyBuf)
+	n.inotifyBuf = append(n.inotifyBuf[:0], rest...)
+}
+
+func (g *GamepadsForTesting) WatchDescriptor(dir string) int32 {
+	for wd, d := range g.gamepads.native.(*nativeGamepadsImpl).watches {
+		if d == dir {
+			return wd
+		}
+	}
+	return -1
+}
+
+func (g *GamepadsForTesting) SetMaxGamepads(n int) {
+	g.gamepads.native.(*nativeGamepadsImpl).setMaxGamepads(n)
+}
+
+func (g *GamepadsForTesting) IsFull() bool {
+	return g.gamepads.native.(*nativeGamepadsImpl).isFull(&g.gamepads)
+}
+
+func (g *GamepadsForTesting) OpenFailureCount(path string) int {
+	f := g.gamepads.native.(*nativeGamepadsImpl).openFailures[path]
+	if f == nil {
+		return 0
+	}
+	return f.count
+}
+
+func (g *GamepadsForTesting) IgnoreRawInputs(buttonCodes []int, axisCodes []int) {
+	g.gamepads.native.(*nativeGamepadsImpl).ignoreRawInputs(buttonCodes, axisCodes)
+}
+
+func (g *GamepadsForTesting) SetNonGamepadDevicesAllowed(allowed bool) {
+	g.gamepads.native.(*nativeGamepadsImpl).setNonGamepadDevicesAllowed(allowed)
+}
+
+func (g *GamepadsForTesting) IsDeviceAccepted(evTypes []int, keys []int) bool {
+	evBits := make([]byte, (unix.EV_CNT+7)/8)
+	for _, typ := range evTypes {
+		evBits[typ/8] |= 1 << (typ % 8)
+	}
+	keyBits := make([]byte, (_KEY_CNT+7)/8)
+	for _, code := range keys {
+		keyBits[code/8] |= 1 << (code % 8)
+	}
+	return g.gamepads.native.(*nativeGamepadsImpl).isDeviceAccepted(evBits, guessDeviceKind(keyBits))
+}
+
+func GuessDeviceKindForTesting(keys []int) DeviceKind {
+	keyBits := make([]byte, (_KEY_CNT+7)/8)
+	for _, code := range keys {
+		keyBits[code/8] |= 1 << (code % 8)
+	}
+	return guessDeviceKind(keyBits)
+}
+
+// IoctlGetIDForTesting calls the EVIOCGID ioctl for the file descriptor.
+func IoctlGetIDForTesting(fd int) error {
+	var id input_id
+	return ioctl(fd, _EVIOCGID(), unsafe.Pointer(&id))
+}
+
+func EncodeInputEventForTesting(timestamp time.Duration, typ, code uint16, value int32) []byte {
+	e := input_event{
+		time:  unix.NsecToTimeval(int64(timestamp)),
+		typ:   typ,
+		code:  code,
+		value: value,
+	}
+	buf := make([]byte, unsafe.Sizeof(e))
+	copy(buf, unsafe.Slice((*byte)(unsafe.Pointer(&e)), unsafe.Sizeof(e)))
+	return buf
+}
+
+func DecodeInputEventForTesting(buf []byte) (timestamp time.Duration, typ, code uint16, value int32) {
+	e := decodeInputEvent(buf)
+	return e.timestamp(), e.typ, e.code, e.value
+}
+
+// FakeClockForTesting is a clock that advances only when Advance is called.
+type FakeClockForTesting struct {
+	now    time.Time
+	timers []*fakeTimer
+	m      sync.Mutex
+}
+
+type fakeTimer struct {
+	clock *FakeClockForTesting
+	at    time.Time
+	f     func()
+	done  bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.m.Lock()
+	defer t.clock.m.Unlock()
+
+	if t.done {
+		return false
+	}
+	t.done = true
+	return true
+}
+
+func NewFakeClockForTesting() *FakeClockForTesting {
+	return &FakeClockForTesting{
+		now: time.Unix(0, 0),
+	}
+}
+
+func (c *FakeClockForTesting) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClockForTesting) AfterFunc(d time.Duration, f func()) timer {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	t := &fakeTimer{
+		clock: c,
+		at:    c.now.Add(d),
+		f:     f,
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance advances the clock and fires the timers that are due.
+func (c *FakeClockForTesting) Advance(d time.Duration) {
+	c.m.Lock()
+	c.now = c.now.Add(d)
+	var fired []*fakeTimer
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.done {
+			continue
+		}
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.done = true
+		fired = append(fired, t)
+	}
+	c.timers = timers
+	c.m.Unlock()
+
+	// Fire the timers without the lock, as a timer might use the clock.
+	for _, t := range fired {
+		t.f()
+	}
+}
@@ -15,6 +15,8 @@
 package gamepad
 
 import (
+	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -23,6 +25,56 @@ import (
 
 type ID int
 
+// DeviceKind represents the kind of a device recognized as a gamepad.
+type DeviceKind int
+
+const (
+	DeviceKindUnknown DeviceKind = iota
+	DeviceKindGamepad
+	DeviceKindTouchpad
+	DeviceKindTablet
+)
+
+// ButtonKind represents the category of a button, which helps to choose default bindings without a mapping.
+type ButtonKind int
+
+const (
+	ButtonKindUnknown ButtonKind = iota
+	ButtonKindFace
+	ButtonKindShoulder
+	ButtonKindTrigger
+	ButtonKindThumb
+	ButtonKindDPad
+	ButtonKindSystem
+)
+
+// Effects is a set of force-feedback effects.
+type Effects int
+
+const (
+	EffectRumble Effects = 1 << iota
+	EffectPeriodic
+	EffectConstant
+	EffectSpring
+	EffectFriction
+	EffectDamper
+	EffectInertia
+	EffectRamp
+)
+
+// StickAxis represents a commonly used axis guessed from the device's axis codes without any mapping.
+// StickAxis is a fallback for the devices that don't have the standard layout.
+type StickAxis int
+
+const (
+	StickAxisLeftX StickAxis = iota
+	StickAxisLeftY
+	StickAxisRightX
+	StickAxisRightY
+	StickAxisLeftTrigger
+	StickAxisRightTrigger
+)
+
 const (
 	hatCentered  = 0
 	hatUp        = 1
@@ -35,11 +87,70 @@ const (
 	hatLeftDown  = hatLeft | hatDown
 )
 
+// RecordedEvent is a raw event recorded from a gamepad.
+// RecordedEvent can be serialized as JSON.
+type RecordedEvent struct {
+	// Frame is the number of the updates from the start of the recording to the event.
+	Frame int `json:"frame"`
+
+	// Time is the timestamp of the event reported by the device.
+	Time time.Duration `json:"time"`
+
+	// Type, Code and Value are the platform-specific raw event, like the type, the code and the value of an evdev event on Linux.
+	Type  uint16 `json:"type"`
+	Code  uint16 `json:"code"`
+	Value int32  `json:"value"`
+}
+
+type systemButton int
+
+const (
+	systemButtonStart systemButton = iota
+	systemButtonSelect
+	systemButtonGuide
+)
+
+// ResponseCurve shapes an axis value.
+// A ResponseCurve takes the absolute value of an axis in [0, 1] and returns a value in [0, 1].
+// The sign of the axis value is kept.
+type ResponseCurve func(v float64) float64
+
+// QuadraticResponseCurve makes small movements finer.
+func QuadraticResponseCurve(v float64) float64 {
+	return v * v
+}
+
+func applyResponseCurve(curve ResponseCurve, v float64) float64 {
+	if curve == nil {
+		return v
+	}
+	sign := 1.0
+	if v < 0 {
+		sign = -1
+		v = -v
+	}
+	v = curve(math.Min(v, 1))
+	if v < 0 {
+		v = 0
+	}
+	if v > 1 {
+		v = 1
+	}
+	return sign * v
+}
+
 type gamepads struct {
 	inited   bool
 	gamepads []*Gamepad
 	m        sync.Mutex
 
+	// deviceErrs is the errors specific to devices during an update.
+	deviceErrs   []error
+	errorHandler func(err error)
+
+	// clock is the source of the time. nil means the real clock.
+	clock clock
+
 	native nativeGamepads
 }
 
@@ -62,6 +173,18 @@ func Update() error {
 	return theGamepads.update()
 }
 
+// SetErrorHandler sets a function to receive errors specific to a device, like an error reading a device.
+// Such errors don't stop updating other devices.
+// If the handler is nil, which is the default, Update returns the first of such errors.
+// Errors not specific to a device are always returned from Update.
+//
+// The handler is called from Update, and must not call SetErrorHandler.
+//
+// SetErrorHandler is concurrent-safe.
+func SetErrorHandler(handler func(err error)) {
+	theGamepads.setErrorHandler(handler)
+}
+
 // Get is concurrent-safe.
 func Get(id ID) *Gamepad {
 	return theGamepads.get(id)
@@ -71,6 +194,49 @@ func SetNativeWindow(nativeWindow uintptr) {
 	theGamepads.setNativeWindow(nativeWindow)
 }
 
+// SetDeviceDirectories sets the directories to find gamepad devices, e.g. for virtual devices created by remapping daemons.
+// The devices in all the directories are treated as one set. SetDeviceDirectories must be called before the first Update.
+//
+// SetDeviceDirectories works only on Linux so far, where the default directory is /dev/input.
+//
+// SetDeviceDirectories is concurrent-safe.
+func SetDeviceDirectories(dirs []string) {
+	theGamepads.setDeviceDirectories(dirs)
+}
+
+// SetNonGamepadDevicesAllowed sets whether devices that don't look like gamepads are recognized as gamepads.
+// This is for unusual hardware without the usual gamepad buttons. Devices connected after this call are affected.
+// The default is false.
+//
+// SetNonGamepadDevicesAllowed works only on Linux so far.
+//
+// SetNonGamepadDevicesAllowed is concurrent-safe.
+func SetNonGamepadDevicesAllowed(allowed bool) {
+	theGamepads.setNonGamepadDevicesAllowed(allowed)
+}
+
+// SetMaxGamepads sets the maximum number of the connected gamepads.
+// Devices connected beyond the maximum are ignored, and reported to the error handler set by SetErrorHandler.
+// Disconnecting a gamepad makes room for a device connected later.
+// 0 or less means no limit, which is the default.
+//
+// SetMaxGamepads works only on Linux so far.
+//
+// SetMaxGamepads is concurrent-safe.
+func SetMaxGamepads(n int) {
+	theGamepads.setMaxGamepads(n)
+}
+
+// IgnoreRawInputs makes gamepads connected after this call ignore the given platform-specific button and axis codes.
+// Ignored inputs don't consume button or axis indices.
+//
+// IgnoreRawInputs works only on Linux so far, where the codes are evdev codes like BTN_* and ABS_*.
+//
+// IgnoreRawInputs is concurrent-safe.
+func IgnoreRawInputs(buttonCodes []int, axisCodes []int) {
+	theGamepads.ignoreRawInputs(buttonCodes, axisCodes)
+}
+
 func (g *gamepads) appendGamepadIDs(ids []ID) []ID {
 	g.m.Lock()
 	defer g.m.Unlock()
@@ -84,18 +250,38 @@ func (g *gamepads) appendGamepadIDs(ids []ID) []ID {
 }
 
 func (g *gamepads) update() error {
+	errs, handler, err := g.updateAndCollectDeviceErrors()
+	if err != nil {
+		return err
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if handler == nil {
+		return errs[0]
+	}
+	// Call the handler without the lock, as the handler might call other functions.
+	for _, err := range errs {
+		handler(err)
+	}
+	return nil
+}
+
+func (g *gamepads) updateAndCollectDeviceErrors() ([]error, func(err error), error) {
 	g.m.Lock()
 	defer g.m.Unlock()
 
+	g.deviceErrs = g.deviceErrs[:0]
+
 	if !g.inited {
 		if err := g.native.init(g); err != nil {
-			return err
+			return nil, nil, err
 		}
 		g.inited = true
 	}
 
 	if err := g.native.update(g); err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// A gamepad can be detected even though there are not. Apparently, some special devices are
@@ -109,11 +295,33 @@ func (g *gamepads) update() error {
 		if gp == nil {
 			continue
 		}
+		// An error for a gamepad must not stop updating the other gamepads.
 		if err := gp.update(g); err != nil {
-			return err
+			g.addDeviceError(err)
 		}
 	}
-	return nil
+
+	return append([]error{}, g.deviceErrs...), g.errorHandler, nil
+}
+
+// addDeviceError records an error specific to a device. The error doesn't stop the update.
+func (g *gamepads) addDeviceError(err error) {
+	g.deviceErrs = append(g.deviceErrs, err)
+}
+
+// getClock returns the clock for the time-dependent features, which is the real clock unless it is replaced.
+func (g *gamepads) getClock() clock {
+	if g.clock == nil {
+		return realClock{}
+	}
+	return g.clock
+}
+
+func (g *gamepads) setErrorHandler(handler func(err error)) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.errorHandler = handler
 }
 
 func (g *gamepads) get(id ID) *Gamepad {
@@ -179,11 +387,58 @@ func (g *gamepads) setNativeWindow(nativeWindow uintptr) {
 	}
 }
 
+func (g *gamepads) setDeviceDirectories(dirs []string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setDirNames([]string) }); ok {
+		n.setDirNames(append([]string{}, dirs...))
+	}
+}
+
+func (g *gamepads) setNonGamepadDevicesAllowed(allowed bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setNonGamepadDevicesAllowed(bool) }); ok {
+		n.setNonGamepadDevicesAllowed(allowed)
+	}
+}
+
+func (g *gamepads) setMaxGamepads(n int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var native any = g.native
+	if native, ok := native.(interface{ setMaxGamepads(int) }); ok {
+		native.setMaxGamepads(n)
+	}
+}
+
+func (g *gamepads) ignoreRawInputs(buttonCodes []int, axisCodes []int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ ignoreRawInputs([]int, []int) }); ok {
+		n.ignoreRawInputs(buttonCodes, axisCodes)
+	}
+}
+
 type Gamepad struct {
 	name  string
 	sdlID string
 	m     sync.Mutex
 
+	// disabled reports whether the inputs are ignored.
+	// The native gamepad is still updated so that the events don't build up.
+	disabled bool
+
+	// eventQueue is the queue of the input changes. nil means the queue is disabled.
+	eventQueue *eventQueue
+
 	native nativeGamepad
 }
 
@@ -254,7 +509,13 @@ func (g *Gamepad) update(gamepads *gamepads) error {
 	g.m.Lock()
 	defer g.m.Unlock()
 
-	return g.native.update(gamepads)
+	if err := g.native.update(gamepads); err != nil {
+		return err
+	}
+	if g.eventQueue != nil && !g.disabled {
+		g.eventQueue.detect(g.native)
+	}
+	return nil
 }
 
 // Name is concurrent-safe.
@@ -272,6 +533,118 @@ func (g *Gamepad) SDLID() string {
 	return g.sdlID
 }
 
+// SDLMapping returns a candidate line for the SDL game controller DB, based on the gamepad's own standard layout.
+// This helps to contribute a mapping for a gamepad that the DB doesn't know.
+// SDLMapping returns false when the gamepad doesn't have its own standard layout.
+//
+// SDLMapping is concurrent-safe.
+func (g *Gamepad) SDLMapping() (string, bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if !g.native.hasOwnStandardLayoutMapping() {
+		return "", false
+	}
+
+	buttons := map[gamepaddb.StandardButton]string{}
+	for b := gamepaddb.StandardButton(0); b <= gamepaddb.StandardButtonMax; b++ {
+		if e, ok := mappingElement(g.native.standardButtonInOwnMapping(b)); ok {
+			buttons[b] = e
+		}
+	}
+	axes := map[gamepaddb.StandardAxis]string{}
+	for a := gamepaddb.StandardAxis(0); a <= gamepaddb.StandardAxisMax; a++ {
+		if e, ok := mappingElement(g.native.standardAxisInOwnMapping(a)); ok {
+			axes[a] = e
+		}
+	}
+	return gamepaddb.FormatMapping(g.sdlID, g.name, buttons, axes), true
+}
+
+// SetMapping applies a mapping line in the SDL game controller DB format to the gamepad immediately.
+// The GUID in the line is ignored, and can be empty. The mapping is stored in the process-wide mapping DB keyed by the SDL ID of this gamepad,
+// so it applies to all the gamepads with the same SDL ID, including the ones connected later, until it is overwritten.
+// SetMapping returns an error if the line is invalid or not for the current platform, and then the mapping is not changed.
+//
+// SetMapping is concurrent-safe.
+func (g *Gamepad) SetMapping(mapping string) error {
+	// sdlID is immutable and doesn't have to be protected by a mutex.
+	return gamepaddb.SetMapping(g.sdlID, mapping)
+}
+
+func mappingElement(m mappingInput) (string, bool) {
+	switch m := m.(type) {
+	case axisMappingInput:
+		return fmt.Sprintf("a%d", m.axis), true
+	case buttonMappingInput:
+		return fmt.Sprintf("b%d", m.button), true
+	case hatMappingInput:
+		return fmt.Sprintf("h%d.%d", m.hat, m.direction), true
+	default:
+		return "", false
+	}
+}
+
+// DeviceKind returns the guessed kind of the device.
+// DeviceKind returns DeviceKindUnknown when the platform doesn't guess it.
+//
+// DeviceKind is concurrent-safe.
+func (g *Gamepad) DeviceKind() DeviceKind {
+	// This is immutable and doesn't have to be protected by a mutex.
+	var n any = g.native
+	if n, ok := n.(interface{ deviceKind() DeviceKind }); ok {
+		return n.deviceKind()
+	}
+	return DeviceKindUnknown
+}
+
+// VendorID returns the vendor ID of the device.
+// VendorID returns 0 when the platform doesn't provide it.
+//
+// VendorID is concurrent-safe.
+func (g *Gamepad) VendorID() uint16 {
+	// This is immutable and doesn't have to be protected by a mutex.
+	var n any = g.native
+	if n, ok := n.(interface{ vendorID() uint16 }); ok {
+		return n.vendorID()
+	}
+	return 0
+}
+
+// ProductID returns the product ID of the device.
+// ProductID returns 0 when the platform doesn't provide it.
+//
+// ProductID is concurrent-safe.
+func (g *Gamepad) ProductID() uint16 {
+	// This is immutable and doesn't have to be protected by a mutex.
+	var n any = g.native
+	if n, ok := n.(interface{ productID() uint16 }); ok {
+		return n.productID()
+	}
+	return 0
+}
+
+// Version returns the version number of the device.
+// Version returns 0 when the platform doesn't provide it.
+//
+// Version is concurrent-safe.
+func (g *Gamepad) Version() uint16 {
+	// This is immutable and doesn't have to be protected by a mutex.
+	var n any = g.native
+	if n, ok := n.(interface{ version() uint16 }); ok {
+		return n.version()
+	}
+	return 0
+}
+
+// DebugString returns a one-line summary of the device capabilities for bug reports.
+//
+// DebugString is concurrent-safe.
+func (g *Gamepad) DebugString() string {
+	return fmt.Sprintf("%q (SDL ID: %s, vendor: 0x%04x, product: 0x%04x, version: 0x%04x, axes: %d, buttons: %d, hats: %d, force feedback: %t)",
+		g.Name(), g.SDLID(), g.VendorID(), g.ProductID(), g.Version(), g.AxisCount(), g.ButtonCount(), g.HatCount(), g.SupportedEffects() != 0)
+}
+
 // AxisCount is concurrent-safe.
 func (g *Gamepad) AxisCount() int {
 	g.m.Lock()
@@ -296,30 +669,529 @@ func (g *Gamepad) HatCount() int {
 	return g.native.hatCount()
 }
 
+// EstimatedPollInterval returns the average interval between the recent updates that read new events.
+// A long interval compared with the update rate means that most updates found no events.
+// EstimatedPollInterval returns 0 when the interval is not known yet or the platform doesn't track it.
+//
+// EstimatedPollInterval is concurrent-safe.
+func (g *Gamepad) EstimatedPollInterval() time.Duration {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ estimatedPollInterval() time.Duration }); ok {
+		return n.estimatedPollInterval()
+	}
+	return 0
+}
+
+// ButtonRawCode returns the platform-specific code of the button, e.g. an evdev code like BTN_SOUTH on Linux.
+// ButtonRawCode returns false when the button doesn't exist or the platform doesn't provide codes.
+//
+// ButtonRawCode is concurrent-safe.
+func (g *Gamepad) ButtonRawCode(button int) (int, bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ buttonRawCode(int) (int, bool) }); ok {
+		return n.buttonRawCode(button)
+	}
+	return 0, false
+}
+
+// StartPressed reports whether the start button is pressed, regardless of the button's index.
+// StartPressed returns false when the gamepad doesn't have the button.
+//
+// StartPressed works only on Linux so far.
+//
+// StartPressed is concurrent-safe.
+func (g *Gamepad) StartPressed() bool {
+	return g.isSystemButtonPressed(systemButtonStart)
+}
+
+// SelectPressed reports whether the select (or back) button is pressed, regardless of the button's index.
+// SelectPressed returns false when the gamepad doesn't have the button.
+//
+// SelectPressed works only on Linux so far.
+//
+// SelectPressed is concurrent-safe.
+func (g *Gamepad) SelectPressed() bool {
+	return g.isSystemButtonPressed(systemButtonSelect)
+}
+
+// GuidePressed reports whether the guide (or home) button is pressed, regardless of the button's index.
+// GuidePressed returns false when the gamepad doesn't have the button.
+//
+// GuidePressed works only on Linux so far.
+//
+// GuidePressed is concurrent-safe.
+func (g *Gamepad) GuidePressed() bool {
+	return g.isSystemButtonPressed(systemButtonGuide)
+}
+
+func (g *Gamepad) isSystemButtonPressed(button systemButton) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.disabled {
+		return false
+	}
+	var n any = g.native
+	if n, ok := n.(interface{ isSystemButtonPressed(systemButton) bool }); ok {
+		return n.isSystemButtonPressed(button)
+	}
+	return false
+}
+
+// ButtonKind returns the category of the button.
+// ButtonKind returns ButtonKindUnknown when the category is unknown or the platform doesn't provide it.
+//
+// ButtonKind works only on Linux so far.
+//
+// ButtonKind is concurrent-safe.
+func (g *Gamepad) ButtonKind(button int) ButtonKind {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ buttonKind(int) ButtonKind }); ok {
+		return n.buttonKind(button)
+	}
+	return ButtonKindUnknown
+}
+
+// RawAxisValue returns the value of the axis as the device reported, before any normalization.
+// RawAxisValue returns false when the axis doesn't exist, the gamepad is disabled, or the platform doesn't provide raw values.
+//
+// RawAxisValue is concurrent-safe.
+func (g *Gamepad) RawAxisValue(axis int) (int32, bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.disabled {
+		return 0, false
+	}
+	var n any = g.native
+	if n, ok := n.(interface{ rawAxisValue(int) (int32, bool) }); ok {
+		return n.rawAxisValue(axis)
+	}
+	return 0, false
+}
+
+// AxisRange returns the range of the raw values of the axis.
+// AxisRange returns false when the axis doesn't exist or the platform doesn't provide the range.
+//
+// AxisRange is concurrent-safe.
+func (g *Gamepad) AxisRange(axis int) (min, max int32, ok bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface {
+		axisRange(int) (int32, int32, bool)
+	}); ok {
+		return n.axisRange(axis)
+	}
+	return 0, 0, false
+}
+
+// AxisResolution returns the resolution of the axis reported by the device, like the units per millimeter for a touchpad.
+// AxisResolution returns 0 when the resolution is unspecified, the axis doesn't exist, or the platform doesn't provide it.
+//
+// AxisResolution works only on Linux so far.
+//
+// AxisResolution is concurrent-safe.
+func (g *Gamepad) AxisResolution(axis int) int32 {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ axisResolution(int) int32 }); ok {
+		return n.axisResolution(axis)
+	}
+	return 0
+}
+
+// SetAxisCalibration overwrites the range of the raw values of the axis, which the axis value is normalized with.
+// The current axis value is updated immediately.
+// SetAxisCalibration returns an error when min is not less than max.
+//
+// SetAxisCalibration works only on Linux so far.
+//
+// SetAxisCalibration is concurrent-safe.
+func (g *Gamepad) SetAxisCalibration(axis int, min, max int32) error {
+	if min >= max {
+		return fmt.Errorf("gamepad: min (%d) must be less than max (%d)", min, max)
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setAxisCalibration(int, int32, int32) }); ok {
+		n.setAxisCalibration(axis, min, max)
+	}
+	return nil
+}
+
+// SetAxisResponseCurve sets the response curve of the axis. A nil curve means linear, which is the default.
+//
+// SetAxisResponseCurve works only on Linux so far.
+//
+// SetAxisResponseCurve is concurrent-safe.
+func (g *Gamepad) SetAxisResponseCurve(axis int, curve ResponseCurve) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setAxisResponseCurve(int, ResponseCurve) }); ok {
+		n.setAxisResponseCurve(axis, curve)
+	}
+}
+
+// SetAxisInverted sets whether the sign of the axis value is flipped, e.g. for an "invert Y" setting.
+// The axis is not inverted by default.
+// Note that the standard layout mappings from the gamepad DB already correct the axes that a driver inverts.
+//
+// SetAxisInverted works only on Linux so far.
+//
+// SetAxisInverted is concurrent-safe.
+func (g *Gamepad) SetAxisInverted(axis int, inverted bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setAxisInverted(int, bool) }); ok {
+		n.setAxisInverted(axis, inverted)
+	}
+}
+
+// SetDPadAsHat makes the d-pad reported as BTN_DPAD_* buttons also work as a hat, which follows the other hats.
+// The buttons are still available as buttons, so the d-pad is reported twice while the hat is enabled.
+// The hat is disabled by default.
+//
+// SetDPadAsHat works only on Linux so far.
+//
+// SetDPadAsHat is concurrent-safe.
+func (g *Gamepad) SetDPadAsHat(enabled bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setDPadAsHat(bool) }); ok {
+		n.setDPadAsHat(enabled)
+	}
+}
+
+// SetHatAxesEnabled makes the hats also work as pairs of virtual axes in [-1, 1].
+// The virtual axes follow the real axes in the order of the hats, X first.
+// This keeps intermediate values of hats reporting analog ranges, which Hat collapses into directions.
+// The virtual axes are disabled by default.
+//
+// SetHatAxesEnabled works only on Linux so far.
+//
+// SetHatAxesEnabled is concurrent-safe.
+func (g *Gamepad) SetHatAxesEnabled(enabled bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setHatAxesEnabled(bool) }); ok {
+		n.setHatAxesEnabled(enabled)
+	}
+}
+
+// StartRecording starts recording the raw events of the gamepad.
+// A recording started again discards the previous recorded events.
+// The events filtered out by SetEventFilter are not recorded.
+//
+// StartRecording works only on Linux so far.
+//
+// StartRecording is concurrent-safe.
+func (g *Gamepad) StartRecording() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ startRecording() }); ok {
+		n.startRecording()
+	}
+}
+
+// StopRecording stops recording and returns the recorded events.
+//
+// StopRecording is concurrent-safe.
+func (g *Gamepad) StopRecording() []RecordedEvent {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ stopRecording() []RecordedEvent }); ok {
+		return n.stopRecording()
+	}
+	return nil
+}
+
+// StartPlayback plays back the recorded events instead of the live events, frame by frame from the next update.
+// The live events are discarded until the playback finishes.
+// The events with codes out of the range of their types are ignored.
+//
+// StartPlayback works only on Linux so far.
+//
+// StartPlayback is concurrent-safe.
+func (g *Gamepad) StartPlayback(events []RecordedEvent) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ startPlayback([]RecordedEvent) }); ok {
+		n.startPlayback(events)
+	}
+}
+
+// IsPlayingBack reports whether the gamepad is playing back recorded events.
+//
+// IsPlayingBack is concurrent-safe.
+func (g *Gamepad) IsPlayingBack() bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ isPlayingBack() bool }); ok {
+		return n.isPlayingBack()
+	}
+	return false
+}
+
+// SetEventFilter sets the types of the raw events to process, like EV_KEY and EV_ABS on Linux.
+// The events of the other types are dropped as soon as they are read, except for the synchronization events.
+// By default, all the types are processed.
+//
+// SetEventFilter works only on Linux so far.
+//
+// SetEventFilter is concurrent-safe.
+func (g *Gamepad) SetEventFilter(types []int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setEventFilter([]int) }); ok {
+		n.setEventFilter(types)
+	}
+}
+
+// SetAxisEventsCoalesced sets whether only the last event for each axis in an update is applied.
+// This reduces the work for a burst of events, e.g. from a fast moving stick, and the values after an update are the same.
+// The default is false, where every event is applied.
+//
+// SetAxisEventsCoalesced works only on Linux so far.
+//
+// SetAxisEventsCoalesced is concurrent-safe.
+func (g *Gamepad) SetAxisEventsCoalesced(coalesced bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setAbsEventsCoalesced(bool) }); ok {
+		n.setAbsEventsCoalesced(coalesced)
+	}
+}
+
+// SetTriggerButtonThreshold makes the analog triggers also work as virtual buttons.
+// The virtual buttons follow the real buttons, and are pressed when the trigger's value in [0, 1] exceeds threshold.
+// The trigger's value doesn't reflect SetAxisInverted or SetAxisResponseCurve.
+// A threshold of 0 or less disables the virtual buttons, which is the default.
+// The virtual buttons are not added beyond ButtonCount buttons.
+//
+// SetTriggerButtonThreshold works only on Linux so far, where the triggers are ABS_Z and ABS_RZ.
+//
+// SetTriggerButtonThreshold is concurrent-safe.
+func (g *Gamepad) SetTriggerButtonThreshold(threshold float64) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setTriggerButtonThreshold(float64) }); ok {
+		n.setTriggerButtonThreshold(threshold)
+	}
+}
+
+// SetEnabled sets whether the gamepad's inputs are enabled.
+// While the gamepad is disabled, the axes, the buttons and the hats report neutral values,
+// but the gamepad keeps its ID and keeps consuming the events from the device.
+//
+// SetEnabled is concurrent-safe.
+func (g *Gamepad) SetEnabled(enabled bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.disabled = !enabled
+}
+
+// IsEnabled is concurrent-safe.
+func (g *Gamepad) IsEnabled() bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	return !g.disabled
+}
+
 // Axis is concurrent-safe.
 func (g *Gamepad) Axis(axis int) float64 {
 	g.m.Lock()
 	defer g.m.Unlock()
 
+	if g.disabled {
+		return 0
+	}
 	return g.native.axisValue(axis)
 }
 
+// AxisValueByte returns the value of Axis remapped from [-1, 1] to [0, 255].
+// The center 0 is mapped to 128.
+//
+// AxisValueByte is concurrent-safe.
+func (g *Gamepad) AxisValueByte(axis int) uint8 {
+	v := g.Axis(axis)
+	v = math.Round((v + 1) * 255 / 2)
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// EnableEventQueue enables the queue of the button and axis changes detected at each update, which can be drained by PollEvent.
+// When the queue has capacity events, a new event is handled by policy.
+// If capacity is 0 or less, the queue is disabled and the queued events are discarded.
+//
+// As the changes are detected by comparing the states at updates, a press and a release between two updates are not reported.
+//
+// EnableEventQueue is concurrent-safe.
+func (g *Gamepad) EnableEventQueue(capacity int, policy EventQueueOverflowPolicy) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if capacity <= 0 {
+		g.eventQueue = nil
+		return
+	}
+	g.eventQueue = newEventQueue(capacity, policy, g.native)
+}
+
+// PollEvent removes and returns the oldest event in the queue.
+// PollEvent returns false if the queue is empty or disabled.
+//
+// PollEvent is concurrent-safe and can be called from a goroutine other than the one updating the gamepads.
+func (g *Gamepad) PollEvent() (Event, bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.eventQueue == nil {
+		return Event{}, false
+	}
+	return g.eventQueue.pop()
+}
+
 // Button is concurrent-safe.
 func (g *Gamepad) Button(button int) bool {
 	g.m.Lock()
 	defer g.m.Unlock()
 
+	if g.disabled {
+		return false
+	}
 	return g.native.isButtonPressed(button)
 }
 
+// ButtonMask returns the pressed states of the buttons as a bitmask, where the i-th bit is set when the button i is pressed.
+// Only the first 64 buttons are included, and the buttons after them are never reported.
+//
+// ButtonMask is concurrent-safe.
+func (g *Gamepad) ButtonMask() uint64 {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.disabled {
+		return 0
+	}
+	var mask uint64
+	for i := 0; i < g.native.buttonCount() && i < 64; i++ {
+		if g.native.isButtonPressed(i) {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+// Hat returns the state of the hat as a bitmask of directions: 1 for up, 2 for right, 4 for down and 8 for left.
+// A diagonal direction is a combination of two adjacent directions, e.g. 3 for right-up.
+// Hat returns 0 when the hat is centered or the hat index is out of range.
+//
 // Hat is concurrent-safe.
 func (g *Gamepad) Hat(hat int) int {
 	g.m.Lock()
 	defer g.m.Unlock()
 
+	if g.disabled {
+		return hatCentered
+	}
 	return g.native.hatState(hat)
 }
 
+// AppendHats appends the states of all the hats to hats and returns the extended buffer.
+// The states are in the same format as Hat.
+// Giving a slice that already has enough capacity works efficiently.
+//
+// AppendHats is concurrent-safe.
+func (g *Gamepad) AppendHats(hats []int) []int {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	n := g.native.hatCount()
+	for i := 0; i < n; i++ {
+		if g.disabled {
+			hats = append(hats, hatCentered)
+			continue
+		}
+		hats = append(hats, g.native.hatState(i))
+	}
+	return hats
+}
+
+// AxisTimestamp returns the time of the last event of the axis.
+// AxisTimestamp returns 0 when the platform doesn't provide event timestamps.
+//
+// AxisTimestamp is concurrent-safe.
+func (g *Gamepad) AxisTimestamp(axis int) time.Duration {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ axisTimestamp(int) time.Duration }); ok {
+		return n.axisTimestamp(axis)
+	}
+	return 0
+}
+
+// ButtonTimestamp returns the time of the last event of the button.
+// ButtonTimestamp returns 0 when the platform doesn't provide event timestamps.
+//
+// ButtonTimestamp is concurrent-safe.
+func (g *Gamepad) ButtonTimestamp(button int) time.Duration {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ buttonTimestamp(int) time.Duration }); ok {
+		return n.buttonTimestamp(button)
+	}
+	return 0
+}
+
 // IsStandardLayoutAvailable is concurrent-safe.
 func (g *Gamepad) IsStandardLayoutAvailable() bool {
 	g.m.Lock()
@@ -355,6 +1227,9 @@ func (g *Gamepad) IsStandardButtonAvailable(button gamepaddb.StandardButton) boo
 
 // StandardAxisValue is concurrent-safe.
 func (g *Gamepad) StandardAxisValue(axis gamepaddb.StandardAxis) float64 {
+	if !g.IsEnabled() {
+		return 0
+	}
 	if gamepaddb.HasStandardLayoutMapping(g.sdlID) {
 		return gamepaddb.AxisValue(g.sdlID, axis, g)
 	}
@@ -364,8 +1239,32 @@ func (g *Gamepad) StandardAxisValue(axis gamepaddb.StandardAxis) float64 {
 	return 0
 }
 
+// StickAxisValue returns the value of the axis guessed from the device's axis codes.
+// The value is in [-1, 1] for the sticks, and in [0, 1] for the triggers.
+// StickAxisValue returns 0 if the axis is not found.
+//
+// StickAxisValue works only on Linux so far.
+//
+// StickAxisValue is concurrent-safe.
+func (g *Gamepad) StickAxisValue(axis StickAxis) float64 {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.disabled {
+		return 0
+	}
+	var n any = g.native
+	if n, ok := n.(interface{ stickAxisValue(StickAxis) float64 }); ok {
+		return n.stickAxisValue(axis)
+	}
+	return 0
+}
+
 // StandardButtonValue is concurrent-safe.
 func (g *Gamepad) StandardButtonValue(button gamepaddb.StandardButton) float64 {
+	if !g.IsEnabled() {
+		return 0
+	}
 	if gamepaddb.HasStandardLayoutMapping(g.sdlID) {
 		return gamepaddb.ButtonValue(g.sdlID, button, g)
 	}
@@ -377,6 +1276,9 @@ func (g *Gamepad) StandardButtonValue(button gamepaddb.StandardButton) float64 {
 
 // IsStandardButtonPressed is concurrent-safe.
 func (g *Gamepad) IsStandardButtonPressed(button gamepaddb.StandardButton) bool {
+	if !g.IsEnabled() {
+		return false
+	}
 	if gamepaddb.HasStandardLayoutMapping(g.sdlID) {
 		return gamepaddb.IsButtonPressed(g.sdlID, button, g)
 	}
@@ -393,3 +1295,105 @@ func (g *Gamepad) Vibrate(duration time.Duration, strongMagnitude float64, weakM
 
 	g.native.vibrate(duration, strongMagnitude, weakMagnitude)
 }
+
+// HapticTest vibrates the gamepad shortly with a medium strength, e.g. for a "test vibration" button in settings.
+// HapticTest returns false when the gamepad doesn't support vibration or the platform cannot tell whether it does,
+// and then nothing happens.
+//
+// HapticTest works only on Linux so far.
+//
+// HapticTest is concurrent-safe.
+func (g *Gamepad) HapticTest() bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ isVibrationSupported() bool }); ok && n.isVibrationSupported() {
+		g.native.vibrate(300*time.Millisecond, 0.5, 0.5)
+		return true
+	}
+	return false
+}
+
+// SupportedEffects returns the set of the force-feedback effects the gamepad supports.
+// SupportedEffects returns 0 if the gamepad doesn't support force feedback or the platform doesn't provide it.
+//
+// SupportedEffects works only on Linux so far.
+//
+// SupportedEffects is concurrent-safe.
+func (g *Gamepad) SupportedEffects() Effects {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ supportedEffects() Effects }); ok {
+		return n.supportedEffects()
+	}
+	return 0
+}
+
+// VibrationRemaining returns the remaining time of the current vibration, or 0 if the gamepad is not vibrating.
+//
+// VibrationRemaining works only on Linux so far.
+//
+// VibrationRemaining is concurrent-safe.
+func (g *Gamepad) VibrationRemaining() time.Duration {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ vibrationRemaining() time.Duration }); ok {
+		return n.vibrationRemaining()
+	}
+	return 0
+}
+
+// SetPlayerLED lights the player LED of the given number, which starts with 1, and turns off the other player LEDs.
+// SetPlayerLED does nothing if the gamepad doesn't have player LEDs or the LEDs are not writable.
+// The LED number is unrelated to the player index of InputState.
+//
+// SetPlayerLED works only on Linux so far.
+//
+// SetPlayerLED is concurrent-safe.
+func (g *Gamepad) SetPlayerLED(number int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setPlayerLED(int) }); ok {
+		n.setPlayerLED(number)
+	}
+}
+
+// PlayerLED returns the number of the lit player LED, which starts with 1.
+// PlayerLED returns -1 if the gamepad doesn't have player LEDs, the LEDs are not readable, or no LEDs are lit.
+//
+// PlayerLED works only on Linux so far.
+//
+// PlayerLED is concurrent-safe.
+func (g *Gamepad) PlayerLED() int {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ playerLED() int }); ok {
+		return n.playerLED()
+	}
+	return -1
+}
+
+// SetVibrationGain sets the overall strength of the vibration in [0, 1], which scales the magnitudes of all the subsequent vibrations.
+// The default gain is 1.
+//
+// SetVibrationGain works only on Linux so far.
+//
+// SetVibrationGain is concurrent-safe.
+func (g *Gamepad) SetVibrationGain(gain float64) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	var n any = g.native
+	if n, ok := n.(interface{ setVibrationGain(float64) }); ok {
+		n.setVibrationGain(gain)
+	}
+}
@@ -18,10 +18,13 @@ package gamepad
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -32,15 +35,84 @@ import (
 
 const dirName = "/dev/input"
 
+// readEventCount is the maximum number of the input events read at once.
+const readEventCount = 64
+
+// defaultWatchMask is the inotify events to watch in the device directories.
+// IN_ATTRIB is to get notified when udev is done, and IN_MOVED_TO and IN_MOVED_FROM are for udev setups moving device files.
+const defaultWatchMask = unix.IN_CREATE | unix.IN_ATTRIB | unix.IN_DELETE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM
+
 var reEvent = regexp.MustCompile(`^event[0-9]+$`)
 
 func isBitSet(s []byte, bit int) bool {
 	return s[bit/8]&(1<<(bit%8)) != 0
 }
 
+func clearBits(s []byte, bits []int) {
+	for _, bit := range bits {
+		if bit < 0 || bit/8 >= len(s) {
+			continue
+		}
+		s[bit/8] &^= 1 << (bit % 8)
+	}
+}
+
+// dropUnreadableAbs clears the bits of the abs codes for which readAbsInfo fails, and returns the errors.
+func dropUnreadableAbs(absBits []byte, readAbsInfo func(code int) error) []error {
+	var errs []error
+	for code := 0; code < _ABS_CNT; code++ {
+		if !isBitSet(absBits, code) {
+			continue
+		}
+		if err := readAbsInfo(code); err != nil {
+			absBits[code/8] &^= 1 << (code % 8)
+			errs = append(errs, fmt.Errorf("ioctl for an abs 0x%02x failed: %w", code, err))
+		}
+	}
+	return errs
+}
+
+const (
+	// maxOpenAttempts is the number of failures to open a device before the device is retried with a backoff.
+	maxOpenAttempts = 3
+
+	minOpenRetryInterval = time.Second
+	maxOpenRetryInterval = time.Minute
+)
+
+type openFailure struct {
+	count   int
+	retryAt time.Time
+}
+
 type nativeGamepadsImpl struct {
 	inotify int
-	watch   int
+
+	// watches maps inotify watch descriptors to the watched directories.
+	watches map[int32]string
+
+	// inotifyBuf is the bytes of an incomplete inotify event, which is completed by the next read.
+	inotifyBuf []byte
+
+	// watchMask is the inotify events to watch. 0 means defaultWatchMask.
+	watchMask uint32
+
+	// dirNames is the directories to find devices. nil means the default directory.
+	dirNames []string
+
+	openFailures map[string]*openFailure
+
+	ignoredKeyCodes []int
+	ignoredAbsCodes []int
+
+	nonGamepadDevicesAllowed bool
+
+	// maxGamepads is the maximum number of the connected gamepads. 0 or less means no limit.
+	maxGamepads int
+
+	// open and ioctl access the device files. nil means the system calls.
+	open  func(path string, mode int) (int, error)
+	ioctl func(fd int, request uint, ptr unsafe.Pointer) error
 }
 
 func newNativeGamepadsImpl() nativeGamepads {
@@ -48,9 +120,23 @@ func newNativeGamepadsImpl() nativeGamepads {
 }
 
 func (g *nativeGamepadsImpl) init(gamepads *gamepads) error {
-	// Check the existence of the directory `dirName`.
+	dirNames := g.dirNames
+	if dirNames == nil {
+		dirNames = []string{dirName}
+	}
+
+	for _, dir := range dirNames {
+		if err := g.initDir(gamepads, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *nativeGamepadsImpl) initDir(gamepads *gamepads, dir string) error {
+	// Check the existence of the directory `dir`.
 	var stat unix.Stat_t
-	if err := unix.Stat(dirName, &stat); err != nil {
+	if err := unix.Stat(dir, &stat); err != nil {
 		if err == unix.ENOENT {
 			return nil
 		}
@@ -60,25 +146,34 @@ func (g *nativeGamepadsImpl) init(gamepads *gamepads) error {
 		return nil
 	}
 
-	inotify, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
-	if err != nil {
-		return fmt.Errorf("gamepad: InotifyInit1 failed: %w", err)
+	if g.inotify == 0 {
+		inotify, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+		if err != nil {
+			return fmt.Errorf("gamepad: InotifyInit1 failed: %w", err)
+		}
+		g.inotify = inotify
 	}
-	g.inotify = inotify
 
 	if g.inotify > 0 {
 		// Register for IN_ATTRIB to get notified when udev is done.
 		// This works well in practice but the true way is libudev.
-		watch, err := unix.InotifyAddWatch(g.inotify, dirName, unix.IN_CREATE|unix.IN_ATTRIB|unix.IN_DELETE)
+		mask := g.watchMask
+		if mask == 0 {
+			mask = defaultWatchMask
+		}
+		watch, err := unix.InotifyAddWatch(g.inotify, dir, mask)
 		if err != nil {
 			return fmt.Errorf("gamepad: InotifyAddWatch failed: %w", err)
 		}
-		g.watch = watch
+		if g.watches == nil {
+			g.watches = map[int32]string{}
+		}
+		g.watches[int32(watch)] = dir
 	}
 
-	ents, err := os.ReadDir(dirName)
+	ents, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("gamepad: ReadDir(%s) failed: %w", dirName, err)
+		return fmt.Errorf("gamepad: ReadDir(%s) failed: %w", dir, err)
 	}
 	for _, ent := range ents {
 		if ent.IsDir() {
@@ -87,22 +182,163 @@ func (g *nativeGamepadsImpl) init(gamepads *gamepads) error {
 		if !reEvent.MatchString(ent.Name()) {
 			continue
 		}
-		if err := g.openGamepad(gamepads, filepath.Join(dirName, ent.Name())); err != nil {
-			return err
+		if err := g.openGamepadWithBackoff(gamepads, filepath.Join(dir, ent.Name()), gamepads.getClock().Now()); err != nil {
+			gamepads.addDeviceError(err)
 		}
 	}
 
 	return nil
 }
 
-func (*nativeGamepadsImpl) openGamepad(gamepads *gamepads, path string) (err error) {
-	if gamepads.find(func(gamepad *Gamepad) bool {
-		return gamepad.native.(*nativeGamepadImpl).path == path
-	}) != nil {
+func (g *nativeGamepadsImpl) setDirNames(dirNames []string) {
+	g.dirNames = dirNames
+}
+
+func (g *nativeGamepadsImpl) setNonGamepadDevicesAllowed(allowed bool) {
+	g.nonGamepadDevicesAllowed = allowed
+}
+
+func (g *nativeGamepadsImpl) setMaxGamepads(n int) {
+	g.maxGamepads = n
+}
+
+func (g *nativeGamepadsImpl) ignoreRawInputs(buttonCodes []int, axisCodes []int) {
+	g.ignoredKeyCodes = append(g.ignoredKeyCodes, buttonCodes...)
+	g.ignoredAbsCodes = append(g.ignoredAbsCodes, axisCodes...)
+}
+
+// openDevice opens the device file at path, which can be replaced by open.
+func (g *nativeGamepadsImpl) openDevice(path string, mode int) (int, error) {
+	if g.open == nil {
+		return unix.Open(path, mode, 0)
+	}
+	return g.open(path, mode)
+}
+
+// getIoctl returns the ioctl to access the device files, which can be replaced by ioctl.
+func (g *nativeGamepadsImpl) getIoctl() func(fd int, request uint, ptr unsafe.Pointer) error {
+	if g.ioctl == nil {
+		return ioctl
+	}
+	return g.ioctl
+}
+
+// openGamepadWithBackoff opens the device at path unless the device has kept failing to be opened.
+// The first maxOpenAttempts errors are returned. After that, the device is retried with an exponential backoff
+// and the errors are not returned, so that a broken device node doesn't make every update fail.
+func (g *nativeGamepadsImpl) openGamepadWithBackoff(gamepads *gamepads, path string, now time.Time) error {
+	f := g.openFailures[path]
+	if f != nil && f.count >= maxOpenAttempts && now.Before(f.retryAt) {
 		return nil
 	}
 
-	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK, 0)
+	err := g.openGamepad(gamepads, path)
+	if err == nil {
+		delete(g.openFailures, path)
+		return nil
+	}
+
+	if f == nil {
+		f = &openFailure{}
+		if g.openFailures == nil {
+			g.openFailures = map[string]*openFailure{}
+		}
+		g.openFailures[path] = f
+	}
+	f.count++
+	if f.count < maxOpenAttempts {
+		return err
+	}
+
+	interval := maxOpenRetryInterval
+	if n := f.count - maxOpenAttempts; n < 6 {
+		interval = minOpenRetryInterval << n
+		if interval > maxOpenRetryInterval {
+			interval = maxOpenRetryInterval
+		}
+	}
+	f.retryAt = now.Add(interval)
+	if f.count == maxOpenAttempts {
+		return err
+	}
+	return nil
+}
+
+// sdlIDFromInputID returns a GUID in the same format as SDL's Linux joystick driver.
+// The name is used instead of the vendor and product IDs when they are not available.
+func sdlIDFromInputID(id input_id, name string) string {
+	if id.vendor != 0 && id.product != 0 && id.version != 0 {
+		return fmt.Sprintf("%02x%02x0000%02x%02x0000%02x%02x0000%02x%02x0000",
+			byte(id.bustype), byte(id.bustype>>8),
+			byte(id.vendor), byte(id.vendor>>8),
+			byte(id.product), byte(id.product>>8),
+			byte(id.version), byte(id.version>>8))
+	}
+
+	bs := []byte(name)
+	if len(bs) < 12 {
+		bs = append(bs, make([]byte, 12-len(bs))...)
+	}
+	return fmt.Sprintf("%02x%02x0000%02x%02x%02x%02x%02x%02x%02x%02x%02x%02x%02x%02x",
+		byte(id.bustype), byte(id.bustype>>8),
+		bs[0], bs[1], bs[2], bs[3], bs[4], bs[5], bs[6], bs[7], bs[8], bs[9], bs[10], bs[11])
+}
+
+// isFull reports whether the number of the connected gamepads reached the maximum.
+func (g *nativeGamepadsImpl) isFull(gamepads *gamepads) bool {
+	if g.maxGamepads <= 0 {
+		return false
+	}
+	var n int
+	for _, gp := range gamepads.gamepads {
+		if gp == nil {
+			continue
+		}
+		// A disconnected gamepad doesn't count.
+		if gp.native.(*nativeGamepadImpl).fd == 0 {
+			continue
+		}
+		n++
+	}
+	return n >= g.maxGamepads
+}
+
+// isDeviceAccepted reports whether a device with the given event types and the given kind is treated as a gamepad.
+func (g *nativeGamepadsImpl) isDeviceAccepted(evBits []byte, kind DeviceKind) bool {
+	if !isBitSet(evBits, unix.EV_KEY) {
+		return false
+	}
+	if kind == DeviceKindGamepad {
+		// A device without axes like an arcade stick is still a gamepad as long as it has gamepad buttons.
+		return true
+	}
+	if !g.nonGamepadDevicesAllowed {
+		return false
+	}
+	// Devices without axes and gamepad buttons are very likely keyboards.
+	return isBitSet(evBits, unix.EV_ABS)
+}
+
+func (g *nativeGamepadsImpl) openGamepad(gamepads *gamepads, path string) (err error) {
+	if gp := gamepads.find(func(gamepad *Gamepad) bool {
+		return gamepad.native.(*nativeGamepadImpl).path == path
+	}); gp != nil {
+		if gp.native.(*nativeGamepadImpl).fd != 0 {
+			return nil
+		}
+		// The device was disconnected but the same device file is used again.
+		// The device might have different capabilities, e.g., a wireless dongle switching its mode.
+		// Remove the stale gamepad and recreate it so that all the maps are built from scratch.
+		gamepads.remove(func(gamepad *Gamepad) bool {
+			return gamepad == gp
+		})
+	}
+
+	// Try to open the device with the write permission, which is required for force feedback.
+	fd, err := g.openDevice(path, unix.O_RDWR|unix.O_NONBLOCK)
+	if err == unix.EACCES || err == unix.EPERM {
+		fd, err = g.openDevice(path, unix.O_RDONLY|unix.O_NONBLOCK)
+	}
 	if err != nil {
 		if err == unix.EACCES {
 			return nil
@@ -123,6 +359,7 @@ func (*nativeGamepadsImpl) openGamepad(gamepads *gamepads, path string) (err err
 		}
 	}()
 
+	ioctl := g.getIoctl()
 	evBits := make([]byte, (unix.EV_CNT+7)/8)
 	keyBits := make([]byte, (_KEY_CNT+7)/8)
 	absBits := make([]byte, (_ABS_CNT+7)/8)
@@ -133,28 +370,58 @@ func (*nativeGamepadsImpl) openGamepad(gamepads *gamepads, path string) (err err
 	if err := ioctl(fd, _EVIOCGBIT(unix.EV_KEY, uint(len(keyBits))), unsafe.Pointer(&keyBits[0])); err != nil {
 		return fmt.Errorf("gamepad: ioctl for keyBits failed: %w", err)
 	}
-	if err := ioctl(fd, _EVIOCGBIT(unix.EV_ABS, uint(len(absBits))), unsafe.Pointer(&absBits[0])); err != nil {
-		return fmt.Errorf("gamepad: ioctl for absBits failed: %w", err)
+	// Some devices like arcade sticks have only buttons.
+	if isBitSet(evBits, unix.EV_ABS) {
+		if err := ioctl(fd, _EVIOCGBIT(unix.EV_ABS, uint(len(absBits))), unsafe.Pointer(&absBits[0])); err != nil {
+			return fmt.Errorf("gamepad: ioctl for absBits failed: %w", err)
+		}
 	}
 	if err := ioctl(fd, _EVIOCGID(), unsafe.Pointer(&id)); err != nil {
 		return fmt.Errorf("gamepad: ioctl for an ID failed: %w", err)
 	}
 
-	if !isBitSet(evBits, unix.EV_KEY) {
+	// Ignored codes don't consume indices.
+	clearBits(keyBits, g.ignoredKeyCodes)
+	clearBits(absBits, g.ignoredAbsCodes)
+
+	// Use the monotonic clock for event timestamps. This might fail with old kernels, and then the real time clock is used.
+	clockID := int32(unix.CLOCK_MONOTONIC)
+	_ = ioctl(fd, _EVIOCSCLOCKID(), unsafe.Pointer(&clockID))
+
+	kind := guessDeviceKind(keyBits)
+	if !g.isDeviceAccepted(evBits, kind) {
 		if err := unix.Close(fd); err != nil {
 			return err
 		}
 
 		return nil
 	}
-	if !isBitSet(evBits, unix.EV_ABS) {
+
+	if g.isFull(gamepads) {
 		if err := unix.Close(fd); err != nil {
 			return err
 		}
 
+		// This is not a failure to open the device. Don't retry.
+		gamepads.addDeviceError(fmt.Errorf("gamepad: %s is ignored as the number of the gamepads reached the maximum %d", path, g.maxGamepads))
 		return nil
 	}
 
+	// An axis whose information cannot be read is skipped so that the rest of the device is still available.
+	for _, err := range dropUnreadableAbs(absBits, func(code int) error {
+		var info input_absinfo
+		return ioctl(fd, uint(_EVIOCGABS(uint(code))), unsafe.Pointer(&info))
+	}) {
+		gamepads.addDeviceError(fmt.Errorf("gamepad: an axis of %s is skipped: %w", path, err))
+	}
+
+	var ffBits [(_FF_CNT + 7) / 8]byte
+	if isBitSet(evBits, unix.EV_FF) {
+		if err := ioctl(fd, _EVIOCGBIT(unix.EV_FF, uint(len(ffBits))), unsafe.Pointer(&ffBits[0])); err != nil {
+			return fmt.Errorf("gamepad: ioctl for ffBits failed: %w", err)
+		}
+	}
+
 	cname := make([]byte, 256)
 	name := "Unknown"
 	// TODO: Is it OK to ignore the error here?
@@ -162,26 +429,18 @@ func (*nativeGamepadsImpl) openGamepad(gamepads *gamepads, path string) (err err
 		name = unix.ByteSliceToString(cname)
 	}
 
-	var sdlID string
-	if id.vendor != 0 && id.product != 0 && id.version != 0 {
-		sdlID = fmt.Sprintf("%02x%02x0000%02x%02x0000%02x%02x0000%02x%02x0000",
-			byte(id.bustype), byte(id.bustype>>8),
-			byte(id.vendor), byte(id.vendor>>8),
-			byte(id.product), byte(id.product>>8),
-			byte(id.version), byte(id.version>>8))
-	} else {
-		bs := []byte(name)
-		if len(bs) < 12 {
-			bs = append(bs, make([]byte, 12-len(bs))...)
-		}
-		sdlID = fmt.Sprintf("%02x%02x0000%02x%02x%02x%02x%02x%02x%02x%02x%02x%02x%02x%02x",
-			byte(id.bustype), byte(id.bustype>>8),
-			bs[0], bs[1], bs[2], bs[3], bs[4], bs[5], bs[6], bs[7], bs[8], bs[9], bs[10], bs[11])
-	}
+	sdlID := sdlIDFromInputID(id, name)
 
 	n := &nativeGamepadImpl{
-		path: path,
-		fd:   fd,
+		path:          path,
+		fd:            fd,
+		id:            id,
+		kind:          kind,
+		ffBits:        ffBits,
+		ffEffectID:    -1,
+		vibrationGain: 1,
+		clock:         gamepads.getClock(),
+		ioctl:         ioctl,
 	}
 	gp := gamepads.add(name, sdlID)
 	gp.native = n
@@ -189,46 +448,7 @@ func (*nativeGamepadsImpl) openGamepad(gamepads *gamepads, path string) (err err
 		n.close()
 	})
 
-	var axisCount int
-	var buttonCount int
-	var hatCount int
-	for i := range n.keyMap {
-		n.keyMap[i] = -1
-	}
-	for i := range n.absMap {
-		n.absMap[i] = -1
-	}
-	for code := _BTN_MISC; code < _KEY_CNT; code++ {
-		if !isBitSet(keyBits, code) {
-			continue
-		}
-		n.keyMap[code-_BTN_MISC] = buttonCount
-		buttonCount++
-	}
-	for code := 0; code < _ABS_CNT; code++ {
-		if !isBitSet(absBits, code) {
-			continue
-		}
-		if code >= _ABS_HAT0X && code <= _ABS_HAT3Y {
-			// Write the hat index both for the X and the Y hat axis.
-			// That way, the hat can be referenced using either axis, which is used by the code building hatMappingInput.
-			n.absMap[code] = hatCount
-			code++
-			n.absMap[code] = hatCount
-			hatCount++
-			continue
-		}
-		if err := ioctl(n.fd, uint(_EVIOCGABS(uint(code))), unsafe.Pointer(&n.absInfo[code])); err != nil {
-			return fmt.Errorf("gamepad: ioctl for an abs at openGamepad failed: %w", err)
-		}
-		n.absMap[code] = axisCount
-		axisCount++
-	}
-
-	n.axisCount_ = axisCount
-	n.buttonCount_ = buttonCount
-	n.hatCount_ = hatCount
-
+	n.initInputs(keyBits, absBits)
 	n.computeStandardLayout(id.vendor)
 
 	if err := n.pollAbsState(); err != nil {
@@ -251,29 +471,48 @@ func (g *nativeGamepadsImpl) update(gamepads *gamepads) error {
 		}
 		return fmt.Errorf("gamepad: Read failed: %w", err)
 	}
-	buf = buf[:n]
 
-	for len(buf) > 0 {
+	g.inotifyBuf = append(g.inotifyBuf, buf[:n]...)
+	rest := g.handleInotifyEvents(gamepads, g.inotifyBuf)
+	g.inotifyBuf = append(g.inotifyBuf[:0], rest...)
+	return nil
+}
+
+// handleInotifyEvents handles the complete inotify events in buf, and returns the rest that is a part of an event.
+func (g *nativeGamepadsImpl) handleInotifyEvents(gamepads *gamepads, buf []byte) []byte {
+	// The size of inotify_event without the name.
+	const headerSize = 16
+
+	for len(buf) >= headerSize {
 		e := unix.InotifyEvent{
 			Wd:     int32(buf[0]) | int32(buf[1])<<8 | int32(buf[2])<<16 | int32(buf[3])<<24,
 			Mask:   uint32(buf[4]) | uint32(buf[5])<<8 | uint32(buf[6])<<16 | uint32(buf[7])<<24,
 			Cookie: uint32(buf[8]) | uint32(buf[9])<<8 | uint32(buf[10])<<16 | uint32(buf[11])<<24,
 			Len:    uint32(buf[12]) | uint32(buf[13])<<8 | uint32(buf[14])<<16 | uint32(buf[15])<<24,
 		}
-		name := unix.ByteSliceToString(buf[16 : 16+e.Len-1]) // len includes the null terminate.
-		buf = buf[16+e.Len:]
+		if uint64(len(buf)) < headerSize+uint64(e.Len) {
+			break
+		}
+		// The name is null-terminated and might be padded with nulls. An event for the watched directory itself has no name.
+		name := unix.ByteSliceToString(buf[headerSize : headerSize+e.Len])
+		buf = buf[headerSize+e.Len:]
 		if !reEvent.MatchString(name) {
 			continue
 		}
 
-		path := filepath.Join(dirName, name)
-		if e.Mask&(unix.IN_CREATE|unix.IN_ATTRIB) != 0 {
-			if err := g.openGamepad(gamepads, path); err != nil {
-				return err
+		dir, ok := g.watches[e.Wd]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if e.Mask&(unix.IN_CREATE|unix.IN_ATTRIB|unix.IN_MOVED_TO) != 0 {
+			if err := g.openGamepadWithBackoff(gamepads, path, gamepads.getClock().Now()); err != nil {
+				gamepads.addDeviceError(err)
 			}
 			continue
 		}
-		if e.Mask&unix.IN_DELETE != 0 {
+		if e.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0 {
+			delete(g.openFailures, path)
 			if gp := gamepads.find(func(gamepad *Gamepad) bool {
 				return gamepad.native.(*nativeGamepadImpl).path == path
 			}); gp != nil {
@@ -286,20 +525,101 @@ func (g *nativeGamepadsImpl) update(gamepads *gamepads) error {
 		}
 	}
 
-	return nil
+	return buf
+}
+
+const timeRingBufferSize = 16
+
+// timeRingBuffer keeps the last timeRingBufferSize times.
+type timeRingBuffer struct {
+	times [timeRingBufferSize]time.Time
+	head  int
+	count int
+}
+
+func (r *timeRingBuffer) record(t time.Time) {
+	r.times[r.head] = t
+	r.head = (r.head + 1) % len(r.times)
+	if r.count < len(r.times) {
+		r.count++
+	}
+}
+
+func (r *timeRingBuffer) averageInterval() time.Duration {
+	if r.count < 2 {
+		return 0
+	}
+	newest := r.times[(r.head+len(r.times)-1)%len(r.times)]
+	oldest := r.times[(r.head+len(r.times)-r.count)%len(r.times)]
+	return newest.Sub(oldest) / time.Duration(r.count-1)
 }
 
 type nativeGamepadImpl struct {
-	fd      int
-	path    string
-	keyMap  [_KEY_CNT - _BTN_MISC]int
-	absMap  [_ABS_CNT]int
-	absInfo [_ABS_CNT]input_absinfo
-	dropped bool
+	fd       int
+	path     string
+	id       input_id
+	kind     DeviceKind
+	keyMap   [_KEY_CNT - _BTN_MISC]int
+	keyCodes [_KEY_CNT - _BTN_MISC]int
+	absMap   [_ABS_CNT]int
+	absCodes [_ABS_CNT]int
+	absInfo  [_ABS_CNT]input_absinfo
+	dropped  bool
+
+	// recordedEvents is the events read while recording, and recordingFrame is the number of the updates since the recording started.
+	recording      bool
+	recordedEvents []RecordedEvent
+	recordingFrame int
+
+	// playbackEvents is the events to play back instead of the live events. nil means no playback.
+	playbackEvents []RecordedEvent
+	playbackFrame  int
+
+	// ignoredEventTypes is the bitmask of the event types not to process. EV_SYN is always processed.
+	ignoredEventTypes uint32
+
+	// calibrated reports whether the range in absInfo is overwritten by SetAxisCalibration.
+	calibrated [_ABS_CNT]bool
 
 	axes    [_ABS_CNT]float64
+	rawAxes [_ABS_CNT]int32
 	buttons [_KEY_CNT - _BTN_MISC]bool
-	hats    [4]int
+	hats    []int
+
+	// axisCurves is the response curves of the axes. nil means linear.
+	axisCurves [_ABS_CNT]ResponseCurve
+
+	// axisInverted reports whether the signs of the axes are flipped.
+	axisInverted [_ABS_CNT]bool
+
+	// hatCodes is the X axis code of each hat. The code is -1 for the hat synthesized from the d-pad buttons.
+	hatCodes []int
+
+	// dpadHat is the index of the hat synthesized from the d-pad buttons, or -1 if there is no such hat.
+	// The hat is the last one, and is exposed only when dpadAsHat is true.
+	dpadHat int
+
+	// dpadAsHat reports whether the hat synthesized from the d-pad buttons is exposed.
+	dpadAsHat bool
+
+	// hatAxes is the normalized values of ABS_HAT0X to ABS_HAT3Y.
+	hatAxes [_ABS_HAT3Y - _ABS_HAT0X + 1]float64
+
+	// hatAxesEnabled reports whether the hats are also exposed as virtual axes after the real axes.
+	hatAxesEnabled bool
+
+	// axisTimestamps and buttonTimestamps are the times of the last events.
+	// The clock is CLOCK_MONOTONIC if the kernel supports EVIOCSCLOCKID, or CLOCK_REALTIME otherwise.
+	axisTimestamps   [_ABS_CNT]time.Duration
+	buttonTimestamps [_KEY_CNT - _BTN_MISC]time.Duration
+
+	// absEventsCoalesced reports whether only the last EV_ABS event for each code is applied until the next report.
+	absEventsCoalesced bool
+
+	// pendingAbsEvents is the last EV_ABS events that are not applied yet, and pendingAbsCodes is their codes.
+	pendingAbsEvents [_ABS_CNT]input_event
+	pendingAbs       [_ABS_CNT]bool
+	pendingAbsCodes  []int
 
 	axisCount_   int
 	buttonCount_ int
@@ -307,9 +627,47 @@ type nativeGamepadImpl struct {
 
 	stdAxisMap   map[gamepaddb.StandardAxis]mappingInput
 	stdButtonMap map[gamepaddb.StandardButton]mappingInput
+
+	// triggerButtonAxes is the axis indices of ABS_Z and ABS_RZ exposed as the virtual buttons after the real buttons.
+	triggerButtonAxes []int
+
+	// triggerButtonThreshold is the threshold for the virtual trigger buttons. 0 disables them.
+	triggerButtonThreshold float64
+
+	// readTimes is the times of the last updates that read any events.
+	readTimes timeRingBuffer
+
+	// readBuf is the bytes of an incomplete input_event, which is completed by the next read.
+	readBuf []byte
+
+	ffBits         [(_FF_CNT + 7) / 8]byte
+	ffEffectID     int16
+	vibrationTimer timer
+
+	// vibrationEnd is the time when the current vibration ends. This is valid only while vibrationTimer is not nil.
+	vibrationEnd time.Time
+
+	// vibrationGain is the gain applied to the magnitudes in software. This is 1 when the device handles the gain.
+	vibrationGain float64
+
+	// clock is the source of the time for the vibration timer.
+	clock clock
+
+	// ioctl is the ioctl to access the device file.
+	ioctl func(fd int, request uint, ptr unsafe.Pointer) error
+
+	// ffM protects fd from being closed while the vibration timer writes to it.
+	ffM sync.Mutex
 }
 
 func (g *nativeGamepadImpl) close() {
+	g.ffM.Lock()
+	defer g.ffM.Unlock()
+
+	if g.vibrationTimer != nil {
+		g.vibrationTimer.Stop()
+		g.vibrationTimer = nil
+	}
 	if g.fd != 0 {
 		_ = unix.Close(g.fd)
 	}
@@ -317,15 +675,35 @@ func (g *nativeGamepadImpl) close() {
 }
 
 func (g *nativeGamepadImpl) update(gamepad *gamepads) error {
+	if g.recording {
+		defer func() {
+			g.recordingFrame++
+		}()
+	}
+
+	playing := g.playbackEvents != nil
+	if playing {
+		g.playFrame()
+	}
+
 	if g.fd == 0 {
 		return nil
 	}
 
+	var read bool
+	defer func() {
+		if read {
+			g.readTimes.record(gamepad.getClock().Now())
+		}
+	}()
+
+	const eventSize = int(unsafe.Sizeof(input_event{}))
+	buf := make([]byte, readEventCount*eventSize)
 	for {
-		buf := make([]byte, unsafe.Sizeof(input_event{}))
-		// TODO: Should the returned byte count be cared?
-		if _, err := unix.Read(g.fd, buf); err != nil {
+		n, err := unix.Read(g.fd, buf)
+		if err != nil {
 			if err == unix.EAGAIN {
+				g.flushAbsEvents()
 				break
 			}
 			// Disconnected
@@ -335,48 +713,260 @@ func (g *nativeGamepadImpl) update(gamepad *gamepads) error {
 			}
 			return fmt.Errorf("gamepad: Read failed: %w", err)
 		}
+		if n == 0 {
+			g.flushAbsEvents()
+			break
+		}
+
+		read = true
+
+		// A read might end in the middle of an event. Keep the incomplete event until the next read completes it.
+		g.readBuf = append(g.readBuf, buf[:n]...)
+		events := g.readBuf[:len(g.readBuf)/eventSize*eventSize]
+		rest := g.readBuf[len(events):]
+		for len(events) > 0 {
+			e := decodeInputEvent(events[:eventSize])
+			events = events[eventSize:]
+
+			// The filtered events are dropped before anything sees them.
+			if g.isEventIgnored(e.typ) {
+				continue
+			}
+			// The live events are discarded during a playback.
+			if playing {
+				continue
+			}
+			if g.recording {
+				g.recordedEvents = append(g.recordedEvents, RecordedEvent{
+					Frame: g.recordingFrame,
+					Time:  e.timestamp(),
+					Type:  e.typ,
+					Code:  e.code,
+					Value: e.value,
+				})
+			}
+			if err := g.handleEvent(e); err != nil {
+				g.readBuf = append(g.readBuf[:0], rest...)
+				return err
+			}
+		}
+		g.readBuf = append(g.readBuf[:0], rest...)
+	}
+	return nil
+}
+
+func (g *nativeGamepadImpl) startRecording() {
+	g.recording = true
+	g.recordingFrame = 0
+	g.recordedEvents = nil
+}
+
+func (g *nativeGamepadImpl) stopRecording() []RecordedEvent {
+	events := g.recordedEvents
+	g.recording = false
+	g.recordedEvents = nil
+	return events
+}
+
+func (g *nativeGamepadImpl) startPlayback(events []RecordedEvent) {
+	g.playbackEvents = make([]RecordedEvent, 0, len(events))
+	for _, e := range events {
+		// The events are given by the caller and might be broken. Drop the events that would index out of the tables.
+		if !isEventCodeInRange(e.Type, e.Code) {
+			continue
+		}
+		g.playbackEvents = append(g.playbackEvents, e)
+	}
+	g.playbackFrame = 0
+}
+
+// isEventCodeInRange reports whether the code of the event is in the range of the event type.
+func isEventCodeInRange(typ, code uint16) bool {
+	switch typ {
+	case unix.EV_KEY:
+		return code < _KEY_CNT
+	case unix.EV_ABS:
+		return code < _ABS_CNT
+	}
+	return true
+}
+
+func (g *nativeGamepadImpl) isPlayingBack() bool {
+	return g.playbackEvents != nil
+}
+
+// playFrame handles the recorded events for the current frame of the playback.
+func (g *nativeGamepadImpl) playFrame() {
+	for len(g.playbackEvents) > 0 && g.playbackEvents[0].Frame <= g.playbackFrame {
+		e := g.playbackEvents[0]
+		g.playbackEvents = g.playbackEvents[1:]
+		// The synchronization events are skipped, as polling the device would overwrite the recorded state.
+		if e.Type == unix.EV_SYN {
+			continue
+		}
+		if g.isEventIgnored(e.Type) {
+			continue
+		}
+		// Recorded events were valid when they were handled, so errors are not expected here.
+		_ = g.handleEvent(input_event{
+			time:  unix.NsecToTimeval(int64(e.Time)),
+			typ:   e.Type,
+			code:  e.Code,
+			value: e.Value,
+		})
+	}
+	g.flushAbsEvents()
+	g.playbackFrame++
+	if len(g.playbackEvents) == 0 {
+		g.playbackEvents = nil
+	}
+}
+
+func (g *nativeGamepadImpl) handleEvent(e input_event) error {
+	if e.typ == unix.EV_SYN {
+		switch e.code {
+		case _SYN_DROPPED:
+			g.dropped = true
+			g.discardAbsEvents()
+		case _SYN_REPORT:
+			g.dropped = false
+			g.flushAbsEvents()
+			if err := g.pollAbsState(); err != nil {
+				return fmt.Errorf("gamepad: poll absolute state: %w", err)
+			}
+		}
+	}
+	if g.dropped {
+		return nil
+	}
+
+	switch e.typ {
+	case unix.EV_KEY:
+		if int(e.code-_BTN_MISC) < len(g.keyMap) {
+			idx := g.keyMap[e.code-_BTN_MISC]
+			if idx < 0 {
+				return nil
+			}
+			g.buttons[idx] = e.value != 0
+			g.buttonTimestamps[idx] = e.timestamp()
+			if g.dpadHat >= 0 {
+				g.handleDPadEvent(int(e.code), e.value != 0)
+			}
+		}
+	case unix.EV_ABS:
+		if g.absEventsCoalesced {
+			if !g.pendingAbs[e.code] {
+				g.pendingAbs[e.code] = true
+				g.pendingAbsCodes = append(g.pendingAbsCodes, int(e.code))
+			}
+			g.pendingAbsEvents[e.code] = e
+			return nil
+		}
+		g.applyAbsEvent(e)
+	}
+	return nil
+}
+
+func (g *nativeGamepadImpl) handleDPadEvent(code int, pressed bool) {
+	var dir int
+	switch code {
+	case _BTN_DPAD_UP:
+		dir = hatUp
+	case _BTN_DPAD_DOWN:
+		dir = hatDown
+	case _BTN_DPAD_LEFT:
+		dir = hatLeft
+	case _BTN_DPAD_RIGHT:
+		dir = hatRight
+	default:
+		return
+	}
+	if pressed {
+		g.hats[g.dpadHat] |= dir
+	} else {
+		g.hats[g.dpadHat] &^= dir
+	}
+}
+
+func (g *nativeGamepadImpl) applyAbsEvent(e input_event) {
+	g.handleAbsEvent(int(e.code), e.value)
+	if e.code < _ABS_HAT0X || e.code > _ABS_HAT3Y {
+		if idx := g.absMap[e.code]; idx >= 0 {
+			g.axisTimestamps[idx] = e.timestamp()
+		}
+	}
+}
+
+// flushAbsEvents applies the pending EV_ABS events in the order of their codes' first arrivals.
+func (g *nativeGamepadImpl) flushAbsEvents() {
+	for _, code := range g.pendingAbsCodes {
+		g.applyAbsEvent(g.pendingAbsEvents[code])
+	}
+	g.discardAbsEvents()
+}
+
+func (g *nativeGamepadImpl) discardAbsEvents() {
+	for _, code := range g.pendingAbsCodes {
+		g.pendingAbs[code] = false
+	}
+	g.pendingAbsCodes = g.pendingAbsCodes[:0]
+}
+
+// isEventIgnored reports whether the events of the type are filtered out by setEventFilter.
+func (g *nativeGamepadImpl) isEventIgnored(typ uint16) bool {
+	return typ != unix.EV_SYN && typ < 32 && g.ignoredEventTypes&(1<<typ) != 0
+}
 
-		const (
-			offsetTyp   = unsafe.Offsetof(input_event{}.typ)
-			offsetCode  = unsafe.Offsetof(input_event{}.code)
-			offsetValue = unsafe.Offsetof(input_event{}.value)
-		)
-		// time is not used.
-		e := input_event{
-			typ:   uint16(buf[offsetTyp]) | uint16(buf[offsetTyp+1])<<8,
-			code:  uint16(buf[offsetCode]) | uint16(buf[offsetCode+1])<<8,
-			value: int32(buf[offsetValue]) | int32(buf[offsetValue+1])<<8 | int32(buf[offsetValue+2])<<16 | int32(buf[offsetValue+3])<<24,
-		}
-
-		if e.typ == unix.EV_SYN {
-			switch e.code {
-			case _SYN_DROPPED:
-				g.dropped = true
-			case _SYN_REPORT:
-				g.dropped = false
-				if err := g.pollAbsState(); err != nil {
-					return fmt.Errorf("gamepad: poll absolute state: %w", err)
-				}
-			}
-		}
-		if g.dropped {
+func (g *nativeGamepadImpl) setEventFilter(types []int) {
+	var mask uint32
+	for _, typ := range types {
+		if typ < 0 || typ >= 32 {
 			continue
 		}
+		mask |= 1 << typ
+	}
+	g.ignoredEventTypes = ^mask
+}
 
-		switch e.typ {
-		case unix.EV_KEY:
-			if int(e.code-_BTN_MISC) < len(g.keyMap) {
-				idx := g.keyMap[e.code-_BTN_MISC]
-				if idx < 0 {
-					continue
-				}
-				g.buttons[idx] = e.value != 0
-			}
-		case unix.EV_ABS:
-			g.handleAbsEvent(int(e.code), e.value)
-		}
+func (g *nativeGamepadImpl) setAbsEventsCoalesced(coalesced bool) {
+	if !coalesced {
+		g.flushAbsEvents()
 	}
-	return nil
+	g.absEventsCoalesced = coalesced
+}
+
+// decodeInputEvent decodes an input_event in the native layout.
+// The size of the time fields depends on the architecture.
+func decodeInputEvent(buf []byte) input_event {
+	const (
+		offsetSec   = unsafe.Offsetof(input_event{}.time) + unsafe.Offsetof(unix.Timeval{}.Sec)
+		offsetUsec  = unsafe.Offsetof(input_event{}.time) + unsafe.Offsetof(unix.Timeval{}.Usec)
+		sizeSec     = unsafe.Sizeof(unix.Timeval{}.Sec)
+		sizeUsec    = unsafe.Sizeof(unix.Timeval{}.Usec)
+		offsetTyp   = unsafe.Offsetof(input_event{}.typ)
+		offsetCode  = unsafe.Offsetof(input_event{}.code)
+		offsetValue = unsafe.Offsetof(input_event{}.value)
+	)
+	sec := decodeInt(buf[offsetSec : offsetSec+sizeSec])
+	usec := decodeInt(buf[offsetUsec : offsetUsec+sizeUsec])
+	return input_event{
+		time:  unix.NsecToTimeval(sec*int64(time.Second) + usec*int64(time.Microsecond)),
+		typ:   uint16(buf[offsetTyp]) | uint16(buf[offsetTyp+1])<<8,
+		code:  uint16(buf[offsetCode]) | uint16(buf[offsetCode+1])<<8,
+		value: int32(buf[offsetValue]) | int32(buf[offsetValue+1])<<8 | int32(buf[offsetValue+2])<<16 | int32(buf[offsetValue+3])<<24,
+	}
+}
+
+// decodeInt decodes a signed little-endian integer of 4 or 8 bytes.
+func decodeInt(buf []byte) int64 {
+	var v uint64
+	for i := len(buf) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(buf[i])
+	}
+	if len(buf) == 4 {
+		return int64(int32(v))
+	}
+	return int64(v)
 }
 
 func (g *nativeGamepadImpl) pollAbsState() error {
@@ -384,10 +974,17 @@ func (g *nativeGamepadImpl) pollAbsState() error {
 		if g.absMap[code] < 0 {
 			continue
 		}
-		if err := ioctl(g.fd, uint(_EVIOCGABS(uint(code))), unsafe.Pointer(&g.absInfo[code])); err != nil {
+		var info input_absinfo
+		if err := g.ioctl(g.fd, uint(_EVIOCGABS(uint(code))), unsafe.Pointer(&info)); err != nil {
 			return fmt.Errorf("gamepad: ioctl for an abs at pollAbsState failed: %w", err)
 		}
-		g.handleAbsEvent(code, g.absInfo[code].value)
+		// Keep the range calibrated by the user.
+		if g.calibrated[code] {
+			info.minimum = g.absInfo[code].minimum
+			info.maximum = g.absInfo[code].maximum
+		}
+		g.absInfo[code] = info
+		g.handleAbsEvent(code, info.value)
 	}
 	return nil
 }
@@ -399,6 +996,11 @@ func (g *nativeGamepadImpl) handleAbsEvent(code int, value int32) {
 	}
 
 	if code >= _ABS_HAT0X && code <= _ABS_HAT3Y {
+		if index >= len(g.hats) {
+			return
+		}
+		g.hatAxes[code-_ABS_HAT0X] = normalizeAbsValue(g.absInfo[code], value)
+
 		axis := (code - _ABS_HAT0X) % 2
 
 		switch axis {
@@ -428,13 +1030,111 @@ func (g *nativeGamepadImpl) handleAbsEvent(code int, value int32) {
 		return
 	}
 
-	info := g.absInfo[code]
+	g.rawAxes[index] = value
+	g.axes[index] = normalizeAbsValue(g.absInfo[code], value)
+}
+
+// normalizeAbsValue normalizes value into [-1, 1] with the range in info.
+func normalizeAbsValue(info input_absinfo, value int32) float64 {
 	v := float64(value)
 	if r := float64(info.maximum) - float64(info.minimum); r != 0 {
 		v = (v - float64(info.minimum)) / r
 		v = v*2 - 1
 	}
-	g.axes[index] = v
+	return v
+}
+
+// guessDeviceKind guesses the kind of the device from its buttons.
+// Touchpads, tablets and accelerometers also report EV_KEY and EV_ABS, so the buttons are what distinguishes gamepads.
+func guessDeviceKind(keyBits []byte) DeviceKind {
+	if isBitSet(keyBits, _BTN_TOOL_PEN) || isBitSet(keyBits, _BTN_STYLUS) {
+		return DeviceKindTablet
+	}
+	if isBitSet(keyBits, _BTN_TOOL_FINGER) {
+		return DeviceKindTouchpad
+	}
+	// BTN_JOYSTICK to BTN_THUMBR includes both joystick buttons (BTN_TRIGGER, ...) and gamepad buttons (BTN_SOUTH, ...).
+	for code := _BTN_JOYSTICK; code <= _BTN_THUMBR; code++ {
+		if isBitSet(keyBits, code) {
+			return DeviceKindGamepad
+		}
+	}
+	for code := _BTN_DPAD_UP; code <= _BTN_DPAD_RIGHT; code++ {
+		if isBitSet(keyBits, code) {
+			return DeviceKindGamepad
+		}
+	}
+	return DeviceKindUnknown
+}
+
+// initInputs builds the maps from evdev codes to the indices of the axes, the buttons and the hats.
+func (g *nativeGamepadImpl) initInputs(keyBits, absBits []byte) {
+	var axisCount int
+	var buttonCount int
+	var hatCount int
+	for i := range g.keyMap {
+		g.keyMap[i] = -1
+	}
+	for i := range g.absMap {
+		g.absMap[i] = -1
+	}
+	for code := _BTN_MISC; code < _KEY_CNT; code++ {
+		if !isBitSet(keyBits, code) {
+			continue
+		}
+		g.keyMap[code-_BTN_MISC] = buttonCount
+		g.keyCodes[buttonCount] = code
+		buttonCount++
+	}
+	g.hatCodes = g.hatCodes[:0]
+	for code := 0; code < _ABS_CNT; code++ {
+		if !isBitSet(absBits, code) {
+			continue
+		}
+		if code >= _ABS_HAT0X && code <= _ABS_HAT3Y {
+			// Write the hat index both for the X and the Y hat axis.
+			// That way, the hat can be referenced using either axis, which is used by the code building hatMappingInput.
+			g.hatCodes = append(g.hatCodes, code-(code-_ABS_HAT0X)%2)
+			g.absMap[code] = hatCount
+			code++
+			g.absMap[code] = hatCount
+			hatCount++
+			continue
+		}
+		g.absMap[code] = axisCount
+		g.absCodes[axisCount] = code
+		axisCount++
+	}
+
+	// Some devices report the d-pad as BTN_DPAD_* buttons instead of ABS_HAT* axes.
+	// Synthesize a hat from the buttons so that the d-pad works as a hat in both cases.
+	// The buttons are still available as buttons.
+	g.dpadHat = -1
+	for code := _BTN_DPAD_UP; code <= _BTN_DPAD_RIGHT; code++ {
+		if isBitSet(keyBits, code) {
+			g.dpadHat = hatCount
+			g.hatCodes = append(g.hatCodes, -1)
+			hatCount++
+			break
+		}
+	}
+	g.hats = make([]int, hatCount)
+
+	g.axisCount_ = axisCount
+	g.buttonCount_ = buttonCount
+	g.hatCount_ = hatCount
+
+	// The virtual trigger buttons must not make the number of the buttons exceed ButtonCount, or the gamepad would be removed.
+	g.triggerButtonAxes = g.triggerButtonAxes[:0]
+	for _, code := range []int{_ABS_Z, _ABS_RZ} {
+		if g.absMap[code] < 0 {
+			continue
+		}
+		if buttonCount+len(g.triggerButtonAxes) >= ButtonCount {
+			break
+		}
+		g.triggerButtonAxes = append(g.triggerButtonAxes, g.absMap[code])
+	}
 }
 
 func (g *nativeGamepadImpl) computeStandardLayout(vendor uint16) {
@@ -581,45 +1281,526 @@ func (g *nativeGamepadImpl) standardButtonInOwnMapping(button gamepaddb.Standard
 }
 
 func (g *nativeGamepadImpl) axisCount() int {
+	if g.hatAxesEnabled {
+		return g.axisCount_ + g.hatCount()*2
+	}
 	return g.axisCount_
 }
 
+func (g *nativeGamepadImpl) setHatAxesEnabled(enabled bool) {
+	g.hatAxesEnabled = enabled
+}
+
 func (g *nativeGamepadImpl) buttonCount() int {
-	return g.buttonCount_
+	return g.buttonCount_ + g.triggerButtonCount()
+}
+
+// triggerButtonCount returns the number of the virtual trigger buttons.
+func (g *nativeGamepadImpl) triggerButtonCount() int {
+	if g.triggerButtonThreshold <= 0 {
+		return 0
+	}
+	return len(g.triggerButtonAxes)
+}
+
+// triggerValue returns the value of the trigger in [0, 1].
+// The response curve and the inversion are not applied so that the threshold and the rest position are kept.
+func (g *nativeGamepadImpl) triggerValue(axis int) float64 {
+	return g.axes[axis]*0.5 + 0.5
+}
+
+func (g *nativeGamepadImpl) setTriggerButtonThreshold(threshold float64) {
+	g.triggerButtonThreshold = threshold
 }
 
 func (g *nativeGamepadImpl) hatCount() int {
+	if g.dpadHat >= 0 && !g.dpadAsHat {
+		return g.hatCount_ - 1
+	}
 	return g.hatCount_
 }
 
+func (g *nativeGamepadImpl) setDPadAsHat(enabled bool) {
+	g.dpadAsHat = enabled
+}
+
 func (g *nativeGamepadImpl) axisValue(axis int) float64 {
+	if axis < 0 || axis >= g.axisCount() {
+		return 0
+	}
+	if axis >= g.axisCount_ {
+		hat := (axis - g.axisCount_) / 2
+		if hat == g.dpadHat {
+			return dpadAxisValue(g.hats[hat], (axis-g.axisCount_)%2)
+		}
+		return g.hatAxes[g.hatCodes[hat]-_ABS_HAT0X+(axis-g.axisCount_)%2]
+	}
+	v := applyResponseCurve(g.axisCurves[axis], g.axes[axis])
+	if g.axisInverted[axis] {
+		return -v
+	}
+	return v
+}
+
+// stickAxisCode returns the ABS code for the axis, or -1 if the device doesn't have it.
+//
+// The left stick is ABS_X and ABS_Y.
+// The right stick is ABS_RX and ABS_RY, or ABS_Z and ABS_RZ if the device doesn't have ABS_RX and ABS_RY.
+// The triggers are ABS_Z and ABS_RZ unless they are used for the right stick, or ABS_BRAKE and ABS_GAS otherwise.
+func (g *nativeGamepadImpl) stickAxisCode(axis StickAxis) int {
+	has := func(code int) bool {
+		return g.absMap[code] >= 0
+	}
+	rightStickOnZ := !has(_ABS_RX) && !has(_ABS_RY)
+
+	var codes []int
+	switch axis {
+	case StickAxisLeftX:
+		codes = []int{_ABS_X}
+	case StickAxisLeftY:
+		codes = []int{_ABS_Y}
+	case StickAxisRightX:
+		codes = []int{_ABS_RX}
+		if rightStickOnZ {
+			codes = []int{_ABS_Z}
+		}
+	case StickAxisRightY:
+		codes = []int{_ABS_RY}
+		if rightStickOnZ {
+			codes = []int{_ABS_RZ}
+		}
+	case StickAxisLeftTrigger:
+		codes = []int{_ABS_Z, _ABS_BRAKE}
+		if rightStickOnZ {
+			codes = []int{_ABS_BRAKE}
+		}
+	case StickAxisRightTrigger:
+		codes = []int{_ABS_RZ, _ABS_GAS}
+		if rightStickOnZ {
+			codes = []int{_ABS_GAS}
+		}
+	}
+	for _, code := range codes {
+		if has(code) {
+			return code
+		}
+	}
+	return -1
+}
+
+func (g *nativeGamepadImpl) stickAxisValue(axis StickAxis) float64 {
+	code := g.stickAxisCode(axis)
+	if code < 0 {
+		return 0
+	}
+	v := g.axisValue(g.absMap[code])
+	if axis == StickAxisLeftTrigger || axis == StickAxisRightTrigger {
+		return (v + 1) / 2
+	}
+	return v
+}
+
+// dpadAxisValue returns the value of the X (0) or Y (1) virtual axis of a hat synthesized from the d-pad buttons.
+func dpadAxisValue(state int, xy int) float64 {
+	neg, pos := hatLeft, hatRight
+	if xy == 1 {
+		neg, pos = hatUp, hatDown
+	}
+	var v float64
+	if state&neg != 0 {
+		v--
+	}
+	if state&pos != 0 {
+		v++
+	}
+	return v
+}
+
+func (g *nativeGamepadImpl) rawAxisValue(axis int) (int32, bool) {
+	if axis < 0 || axis >= g.axisCount_ {
+		return 0, false
+	}
+	return g.rawAxes[axis], true
+}
+
+func (g *nativeGamepadImpl) axisRange(axis int) (min, max int32, ok bool) {
+	if axis < 0 || axis >= g.axisCount_ {
+		return 0, 0, false
+	}
+	info := g.absInfo[g.absCodes[axis]]
+	return info.minimum, info.maximum, true
+}
+
+func (g *nativeGamepadImpl) axisResolution(axis int) int32 {
 	if axis < 0 || axis >= g.axisCount_ {
 		return 0
 	}
-	return g.axes[axis]
+	return g.absInfo[g.absCodes[axis]].resolution
+}
+
+func (g *nativeGamepadImpl) setAxisCalibration(axis int, min, max int32) {
+	if axis < 0 || axis >= g.axisCount_ {
+		return
+	}
+	code := g.absCodes[axis]
+	g.absInfo[code].minimum = min
+	g.absInfo[code].maximum = max
+	g.calibrated[code] = true
+	g.axes[axis] = normalizeAbsValue(g.absInfo[code], g.rawAxes[axis])
+}
+
+func (g *nativeGamepadImpl) setAxisResponseCurve(axis int, curve ResponseCurve) {
+	if axis < 0 || axis >= g.axisCount_ {
+		return
+	}
+	g.axisCurves[axis] = curve
+}
+
+func (g *nativeGamepadImpl) setAxisInverted(axis int, inverted bool) {
+	if axis < 0 || axis >= g.axisCount_ {
+		return
+	}
+	g.axisInverted[axis] = inverted
 }
 
 func (g *nativeGamepadImpl) isButtonPressed(button int) bool {
-	if button < 0 || button >= g.buttonCount_ {
+	if button < 0 || button >= g.buttonCount() {
 		return false
 	}
+	if button >= g.buttonCount_ {
+		return g.triggerValue(g.triggerButtonAxes[button-g.buttonCount_]) > g.triggerButtonThreshold
+	}
 	return g.buttons[button]
 }
 
 func (g *nativeGamepadImpl) buttonValue(button int) float64 {
+	if button >= g.buttonCount_ && button < g.buttonCount() {
+		return g.triggerValue(g.triggerButtonAxes[button-g.buttonCount_])
+	}
 	if g.isButtonPressed(button) {
 		return 1
 	}
 	return 0
 }
 
+func (g *nativeGamepadImpl) buttonRawCode(button int) (int, bool) {
+	if button < 0 || button >= g.buttonCount_ {
+		return 0, false
+	}
+	return g.keyCodes[button], true
+}
+
+func (g *nativeGamepadImpl) isSystemButtonPressed(button systemButton) bool {
+	var code int
+	switch button {
+	case systemButtonStart:
+		code = _BTN_START
+	case systemButtonSelect:
+		code = _BTN_SELECT
+	case systemButtonGuide:
+		code = _BTN_MODE
+	default:
+		return false
+	}
+	idx := g.keyMap[code-_BTN_MISC]
+	if idx < 0 {
+		return false
+	}
+	return g.buttons[idx]
+}
+
+func (g *nativeGamepadImpl) buttonKind(button int) ButtonKind {
+	if button >= g.buttonCount_ && button < g.buttonCount() {
+		return ButtonKindTrigger
+	}
+	code, ok := g.buttonRawCode(button)
+	if !ok {
+		return ButtonKindUnknown
+	}
+	switch code {
+	case _BTN_A, _BTN_B, _BTN_C, _BTN_X, _BTN_Y, _BTN_Z:
+		return ButtonKindFace
+	case _BTN_TL, _BTN_TR:
+		return ButtonKindShoulder
+	case _BTN_TL2, _BTN_TR2:
+		return ButtonKindTrigger
+	case _BTN_THUMBL, _BTN_THUMBR:
+		return ButtonKindThumb
+	case _BTN_DPAD_UP, _BTN_DPAD_DOWN, _BTN_DPAD_LEFT, _BTN_DPAD_RIGHT:
+		return ButtonKindDPad
+	case _BTN_SELECT, _BTN_START, _BTN_MODE:
+		return ButtonKindSystem
+	default:
+		return ButtonKindUnknown
+	}
+}
+
+func (g *nativeGamepadImpl) estimatedPollInterval() time.Duration {
+	return g.readTimes.averageInterval()
+}
+
+func (g *nativeGamepadImpl) deviceKind() DeviceKind {
+	return g.kind
+}
+
+func (g *nativeGamepadImpl) vendorID() uint16 {
+	return g.id.vendor
+}
+
+func (g *nativeGamepadImpl) productID() uint16 {
+	return g.id.product
+}
+
+func (g *nativeGamepadImpl) version() uint16 {
+	return g.id.version
+}
+
+func (g *nativeGamepadImpl) axisTimestamp(axis int) time.Duration {
+	if axis < 0 || axis >= g.axisCount_ {
+		return 0
+	}
+	return g.axisTimestamps[axis]
+}
+
+func (g *nativeGamepadImpl) buttonTimestamp(button int) time.Duration {
+	if button < 0 || button >= g.buttonCount_ {
+		return 0
+	}
+	return g.buttonTimestamps[button]
+}
+
 func (g *nativeGamepadImpl) hatState(hat int) int {
-	if hat < 0 || hat >= g.hatCount_ {
+	if hat < 0 || hat >= g.hatCount() {
 		return hatCentered
 	}
 	return g.hats[hat]
 }
 
 func (g *nativeGamepadImpl) vibrate(duration time.Duration, strongMagnitude float64, weakMagnitude float64) {
-	// TODO: Implement this (#1452)
+	g.ffM.Lock()
+	defer g.ffM.Unlock()
+
+	if g.fd == 0 {
+		return
+	}
+	if !isBitSet(g.ffBits[:], _FF_RUMBLE) {
+		return
+	}
+
+	// A new vibration replaces the current one.
+	if g.vibrationTimer != nil {
+		g.vibrationTimer.Stop()
+		g.vibrationTimer = nil
+	}
+
+	strong, weak := g.rumbleMagnitudes(strongMagnitude, weakMagnitude)
+	if duration <= 0 || (strong == 0 && weak == 0) {
+		_ = g.stopVibration()
+		return
+	}
+
+	length := duration / time.Millisecond
+	if length > 0xffff {
+		length = 0xffff
+	}
+	e := ff_effect{
+		typ: _FF_RUMBLE,
+		id:  g.ffEffectID,
+		replay: ff_replay{
+			length: uint16(length),
+		},
+	}
+	r := (*ff_rumble_effect)(unsafe.Pointer(&e.u))
+	r.strong_magnitude = strong
+	r.weak_magnitude = weak
+
+	// EVIOCSFF updates the effect if the ID is valid, or uploads a new effect and fills the ID otherwise.
+	if err := g.ioctl(g.fd, _EVIOCSFF(), unsafe.Pointer(&e)); err != nil {
+		return
+	}
+	g.ffEffectID = e.id
+
+	if err := g.writeEvent(unix.EV_FF, uint16(g.ffEffectID), 1); err != nil {
+		return
+	}
+
+	g.startVibrationTimer(duration)
+}
+
+// startVibrationTimer starts the timer to stop the current vibration after the duration.
+// Some drivers don't honor replay.length and keep playing the effect until it is stopped explicitly.
+func (g *nativeGamepadImpl) startVibrationTimer(duration time.Duration) {
+	var t timer
+	t = g.clock.AfterFunc(duration, func() {
+		g.ffM.Lock()
+		defer g.ffM.Unlock()
+
+		// The timer might have been replaced after this function was fired.
+		if g.vibrationTimer != t {
+			return
+		}
+		g.vibrationTimer = nil
+		_ = g.stopVibration()
+	})
+	g.vibrationTimer = t
+	g.vibrationEnd = g.clock.Now().Add(duration)
+}
+
+func (g *nativeGamepadImpl) isVibrationSupported() bool {
+	g.ffM.Lock()
+	defer g.ffM.Unlock()
+
+	return g.fd != 0 && isBitSet(g.ffBits[:], _FF_RUMBLE)
+}
+
+func (g *nativeGamepadImpl) supportedEffects() Effects {
+	g.ffM.Lock()
+	defer g.ffM.Unlock()
+
+	var effects Effects
+	for _, e := range []struct {
+		code   int
+		effect Effects
+	}{
+		{_FF_RUMBLE, EffectRumble},
+		{_FF_PERIODIC, EffectPeriodic},
+		{_FF_CONSTANT, EffectConstant},
+		{_FF_SPRING, EffectSpring},
+		{_FF_FRICTION, EffectFriction},
+		{_FF_DAMPER, EffectDamper},
+		{_FF_INERTIA, EffectInertia},
+		{_FF_RAMP, EffectRamp},
+	} {
+		if isBitSet(g.ffBits[:], e.code) {
+			effects |= e.effect
+		}
+	}
+	return effects
+}
+
+func (g *nativeGamepadImpl) vibrationRemaining() time.Duration {
+	g.ffM.Lock()
+	defer g.ffM.Unlock()
+
+	if g.vibrationTimer == nil {
+		return 0
+	}
+	if d := g.vibrationEnd.Sub(g.clock.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (g *nativeGamepadImpl) rumbleMagnitudes(strongMagnitude, weakMagnitude float64) (strong, weak uint16) {
+	return magnitudeToUint16(strongMagnitude * g.vibrationGain), magnitudeToUint16(weakMagnitude * g.vibrationGain)
+}
+
+func (g *nativeGamepadImpl) setVibrationGain(gain float64) {
+	g.ffM.Lock()
+	defer g.ffM.Unlock()
+
+	gain = math.Max(0, math.Min(gain, 1))
+
+	// Let the device scale all the effects if possible.
+	if g.fd != 0 && isBitSet(g.ffBits[:], _FF_GAIN) {
+		if err := g.writeEvent(unix.EV_FF, _FF_GAIN, int32(magnitudeToUint16(gain))); err == nil {
+			g.vibrationGain = 1
+			return
+		}
+	}
+	g.vibrationGain = gain
+}
+
+func (g *nativeGamepadImpl) stopVibration() error {
+	if g.fd == 0 || g.ffEffectID < 0 {
+		return nil
+	}
+	return g.writeEvent(unix.EV_FF, uint16(g.ffEffectID), 0)
+}
+
+func (g *nativeGamepadImpl) writeEvent(typ, code uint16, value int32) error {
+	e := input_event{
+		typ:   typ,
+		code:  code,
+		value: value,
+	}
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&e)), unsafe.Sizeof(e))
+	if _, err := unix.Write(g.fd, buf); err != nil {
+		return fmt.Errorf("gamepad: Write failed: %w", err)
+	}
+	return nil
+}
+
+func magnitudeToUint16(magnitude float64) uint16 {
+	if magnitude <= 0 {
+		return 0
+	}
+	if magnitude >= 1 {
+		return 0xffff
+	}
+	return uint16(magnitude * 0xffff)
+}
+
+// sysClassInputDir is the sysfs directory of the input devices.
+const sysClassInputDir = "/sys/class/input"
+
+// rePlayerLED matches the names of the player LEDs like "input5:white:player-1".
+var rePlayerLED = regexp.MustCompile(`:player-([1-4])$`)
+
+// playerLEDs returns the brightness files of the player LEDs of the device, indexed by the player number minus 1.
+// playerLEDs returns nil if the device has no player LEDs.
+func (g *nativeGamepadImpl) playerLEDs() []string {
+	if g.path == "" {
+		return nil
+	}
+
+	// The LEDs belong to the HID device, which is the parent of the input device.
+	dir := filepath.Join(sysClassInputDir, filepath.Base(g.path), "device", "device", "leds")
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var leds []string
+	for _, ent := range ents {
+		m := rePlayerLED.FindStringSubmatch(ent.Name())
+		if m == nil {
+			continue
+		}
+		if leds == nil {
+			leds = make([]string, 4)
+		}
+		leds[m[1][0]-'1'] = filepath.Join(dir, ent.Name(), "brightness")
+	}
+	return leds
+}
+
+func (g *nativeGamepadImpl) setPlayerLED(number int) {
+	for i, led := range g.playerLEDs() {
+		if led == "" {
+			continue
+		}
+		v := "0"
+		if i+1 == number {
+			v = "1"
+		}
+		// Writing the brightness might require a permission. Ignore the error as there is nothing to do.
+		_ = os.WriteFile(led, []byte(v), 0)
+	}
+}
+
+func (g *nativeGamepadImpl) playerLED() int {
+	for i, led := range g.playerLEDs() {
+		if led == "" {
+			continue
+		}
+		b, err := os.ReadFile(led)
+		if err != nil {
+			continue
+		}
+		if v := strings.TrimSpace(string(b)); v != "" && v != "0" {
+			return i + 1
+		}
+	}
+	return -1
 }
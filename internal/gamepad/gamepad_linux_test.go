@@ -0,0 +1,2389 @@
+// Copyright 2022 The Ebiten Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !android && !nintendosdk
+
+package gamepad_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/hajimehoshi/ebiten/v2/internal/gamepad"
+	"github.com/hajimehoshi/ebiten/v2/internal/gamepaddb"
+)
+
+// The evdev codes used in the tests.
+const (
+	evSyn = 0x00
+	evKey = 0x01
+	evAbs = 0x03
+	evFF  = 0x15
+
+	absX     = 0x00
+	absY     = 0x01
+	absZ     = 0x02
+	absRX    = 0x03
+	absRY    = 0x04
+	absRZ    = 0x05
+	absGas   = 0x09
+	absBrake = 0x0a
+	absHat0X = 0x10
+	absHat0Y = 0x11
+	absHat1X = 0x12
+	absHat1Y = 0x13
+	absHat3Y = 0x17
+
+	keyA         = 0x1e
+	btnSouth     = 0x130
+	btnA         = 0x130
+	btnEast      = 0x131
+	btnB         = 0x131
+	btnNorth     = 0x133
+	btnX         = 0x133
+	btnWest      = 0x134
+	btnY         = 0x134
+	btnTL2       = 0x138
+	btnTR2       = 0x139
+	btnSelect    = 0x13a
+	btnMode      = 0x13c
+	btnDPadUp    = 0x220
+	btnDPadDown  = 0x221
+	btnDPadLeft  = 0x222
+	btnDPadRight = 0x223
+
+	ffRumble   = 0x50
+	ffPeriodic = 0x51
+	ffConstant = 0x52
+	ffRamp     = 0x57
+	ffGain     = 0x60
+)
+
+// newPipe returns the ends of a non-blocking pipe, which are closed at the end of the test.
+func newPipe(t *testing.T) (r, w int) {
+	t.Helper()
+
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_NONBLOCK|unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = unix.Close(p[0])
+		_ = unix.Close(p[1])
+	})
+	return p[0], p[1]
+}
+
+// newGamepads returns the initialized gamepads watching dirs, which are closed at the end of the test.
+func newGamepads(t *testing.T, dirs ...string) *gamepad.GamepadsForTesting {
+	t.Helper()
+
+	g := gamepad.NewGamepadsForTesting()
+	g.SetDirNames(dirs)
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := g.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return g
+}
+
+// openDevice emulates the device at path, whose events are read from fd, and opens it.
+// The gamepad is disconnected at the end of the test.
+func openDevice(t *testing.T, g *gamepad.GamepadsForTesting, path string, device *gamepad.DeviceForTesting, fd int) *gamepad.Gamepad {
+	t.Helper()
+
+	g.SetDevice(path, device, fd)
+	if err := g.OpenGamepad(path, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	gp := g.GamepadByPath(path)
+	if gp == nil {
+		t.Fatalf("the device at %s is not registered", path)
+	}
+	t.Cleanup(gp.DisconnectForTesting)
+	return gp
+}
+
+// writeEvent writes an input event to fd.
+func writeEvent(t *testing.T, fd int, typ, code uint16, value int32) {
+	t.Helper()
+
+	if _, err := unix.Write(fd, gamepad.EncodeInputEventForTesting(0, typ, code, value)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeInputEvent(t *testing.T) {
+	cases := []struct {
+		Timestamp time.Duration
+		Type      uint16
+		Code      uint16
+		Value     int32
+	}{
+		{
+			Timestamp: 0,
+			Type:      0x01,
+			Code:      0x130,
+			Value:     1,
+		},
+		{
+			Timestamp: 12345*time.Second + 678901*time.Microsecond,
+			Type:      0x03,
+			Code:      0x01,
+			Value:     -32768,
+		},
+		{
+			Timestamp: 1<<31*time.Microsecond - time.Microsecond,
+			Type:      0x00,
+			Code:      0x00,
+			Value:     0,
+		},
+	}
+	for _, c := range cases {
+		buf := gamepad.EncodeInputEventForTesting(c.Timestamp, c.Type, c.Code, c.Value)
+		ts, typ, code, value := gamepad.DecodeInputEventForTesting(buf)
+		if ts != c.Timestamp || typ != c.Type || code != c.Code || value != c.Value {
+			t.Errorf("got: (%v, %d, %d, %d), want: (%v, %d, %d, %d)", ts, typ, code, value, c.Timestamp, c.Type, c.Code, c.Value)
+		}
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		BusType: 0x0003, // BUS_USB
+		Vendor:  0x057e,
+		Product: 0x2009,
+		Version: 0x8111,
+		Keys:    []int{0x130, 0x131},
+		Abs:     []int{0x00, 0x01},
+	})
+	if got, want := g.VendorID(), uint16(0x057e); got != want {
+		t.Errorf("VendorID(): got: %#04x, want: %#04x", got, want)
+	}
+	if got, want := g.ProductID(), uint16(0x2009); got != want {
+		t.Errorf("ProductID(): got: %#04x, want: %#04x", got, want)
+	}
+	if got, want := g.Version(), uint16(0x8111); got != want {
+		t.Errorf("Version(): got: %#04x, want: %#04x", got, want)
+	}
+}
+
+func TestButtonRawCode(t *testing.T) {
+	// BTN_SOUTH, BTN_EAST, BTN_NORTH, BTN_WEST, BTN_TL, BTN_TR, BTN_SELECT, BTN_START, BTN_MODE, BTN_DPAD_UP.
+	codes := []int{0x130, 0x131, 0x133, 0x134, 0x136, 0x137, 0x13a, 0x13b, 0x13c, 0x220}
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: codes,
+	})
+	if got, want := g.ButtonCount(), len(codes); got != want {
+		t.Fatalf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+	for i, want := range codes {
+		got, ok := g.ButtonRawCode(i)
+		if !ok || got != want {
+			t.Errorf("ButtonRawCode(%d): got: (%#x, %t), want: (%#x, true)", i, got, ok, want)
+		}
+	}
+	if _, ok := g.ButtonRawCode(len(codes)); ok {
+		t.Errorf("ButtonRawCode(%d): got: true, want: false", len(codes))
+	}
+}
+
+func TestIgnoredAbs(t *testing.T) {
+	r, _ := newPipe(t)
+
+	const path = "/dev/input/event0"
+	gs := gamepad.NewGamepadsForTesting()
+	gs.IgnoreRawInputs(nil, []int{absY})
+	g := openDevice(t, gs, path, &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		Abs:  []int{absX, absY, absZ, absRX},
+	}, r)
+
+	if got, want := g.AxisCount(), 3; got != want {
+		t.Fatalf("AxisCount(): got: %d, want: %d", got, want)
+	}
+
+	// ABS_Y is ignored, so ABS_Z and ABS_RX are shifted to the indices 1 and 2.
+	for i, code := range []uint16{absX, absY, absZ, absRX} {
+		if err := g.HandleEventForTesting(evAbs, code, int32(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []float64{1, 3, 4} {
+		if got := g.Axis(i); got != want {
+			t.Errorf("Axis(%d): got: %f, want: %f", i, got, want)
+		}
+	}
+}
+
+func TestEstimatedPollInterval(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{})
+	if got := g.EstimatedPollInterval(); got != 0 {
+		t.Errorf("EstimatedPollInterval(): got: %v, want: 0", got)
+	}
+
+	// Record more reads than the ring buffer holds. Only the recent ones should count.
+	now := time.Now()
+	for i := 0; i < 8; i++ {
+		now = now.Add(100 * time.Millisecond)
+		g.RecordReadForTesting(now)
+	}
+	for i := 0; i < 32; i++ {
+		now = now.Add(10 * time.Millisecond)
+		g.RecordReadForTesting(now)
+	}
+	if got, want := g.EstimatedPollInterval(), 10*time.Millisecond; got != want {
+		t.Errorf("EstimatedPollInterval(): got: %v, want: %v", got, want)
+	}
+}
+
+func TestTriggerButton(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{0x130, 0x131},
+		Abs:  []int{absZ, absRZ},
+		AbsInfo: map[int][2]int32{
+			absZ:  {0, 255},
+			absRZ: {0, 255},
+		},
+	})
+	if got, want := g.ButtonCount(), 2; got != want {
+		t.Fatalf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+
+	g.SetTriggerButtonThreshold(0.5)
+	if got, want := g.ButtonCount(), 4; got != want {
+		t.Fatalf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+
+	cases := []struct {
+		Z     int32
+		RZ    int32
+		Left  bool
+		Right bool
+	}{
+		{Z: 0, RZ: 0, Left: false, Right: false},
+		{Z: 200, RZ: 0, Left: true, Right: false},
+		{Z: 200, RZ: 255, Left: true, Right: true},
+		{Z: 100, RZ: 255, Left: false, Right: true},
+		{Z: 0, RZ: 0, Left: false, Right: false},
+	}
+	for _, c := range cases {
+		if err := g.HandleEventForTesting(evAbs, absZ, c.Z); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.HandleEventForTesting(evAbs, absRZ, c.RZ); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.Button(2); got != c.Left {
+			t.Errorf("Button(2) with ABS_Z=%d: got: %t, want: %t", c.Z, got, c.Left)
+		}
+		if got := g.Button(3); got != c.Right {
+			t.Errorf("Button(3) with ABS_RZ=%d: got: %t, want: %t", c.RZ, got, c.Right)
+		}
+	}
+}
+
+func TestTriggerButtonWithDigitalTriggers(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{btnSouth, btnTL2, btnTR2},
+		Abs:  []int{absZ, absRZ},
+		AbsInfo: map[int][2]int32{
+			absZ:  {0, 255},
+			absRZ: {0, 255},
+		},
+	})
+	g.SetTriggerButtonThreshold(0.5)
+	if got, want := g.ButtonCount(), 5; got != want {
+		t.Fatalf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+
+	// The digital triggers and the virtual buttons for the analog triggers are independent.
+	for _, e := range [][3]int32{{evKey, btnTL2, 1}, {evAbs, absRZ, 255}} {
+		if err := g.HandleEventForTesting(uint16(e[0]), uint16(e[1]), e[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []bool{false, true, false, false, true} {
+		if got := g.Button(i); got != want {
+			t.Errorf("Button(%d): got: %t, want: %t", i, got, want)
+		}
+	}
+}
+
+func TestTriggerButtonWithInvertedAxis(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{0x130},
+		Abs:  []int{absZ},
+		AbsInfo: map[int][2]int32{
+			absZ: {0, 255},
+		},
+	})
+	g.SetTriggerButtonThreshold(0.5)
+	g.SetAxisInverted(0, true)
+	g.SetAxisResponseCurve(0, gamepad.QuadraticResponseCurve)
+
+	// The inversion and the response curve of the axis don't affect the virtual button.
+	for _, c := range []struct {
+		Z       int32
+		Pressed bool
+	}{
+		{Z: 0, Pressed: false},
+		{Z: 160, Pressed: true},
+		{Z: 0, Pressed: false},
+	} {
+		if err := g.HandleEventForTesting(evAbs, absZ, c.Z); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.Button(1); got != c.Pressed {
+			t.Errorf("Button(1) with ABS_Z=%d: got: %t, want: %t", c.Z, got, c.Pressed)
+		}
+	}
+}
+
+func TestTriggerButtonLimit(t *testing.T) {
+	// The virtual buttons are added only as long as the number of the buttons doesn't exceed ButtonCount.
+	keys := make([]int, gamepad.ButtonCount-1)
+	for i := range keys {
+		keys[i] = 0x120 + i
+	}
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: keys,
+		Abs:  []int{absZ, absRZ},
+		AbsInfo: map[int][2]int32{
+			absZ:  {0, 255},
+			absRZ: {0, 255},
+		},
+	})
+	g.SetTriggerButtonThreshold(0.5)
+	if got, want := g.ButtonCount(), gamepad.ButtonCount; got != want {
+		t.Errorf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+}
+
+func TestHatAxes(t *testing.T) {
+	const hatRight = 2
+
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX, absHat0X, absHat0Y},
+		AbsInfo: map[int][2]int32{
+			absHat0X: {-4, 4},
+			absHat0Y: {-4, 4},
+		},
+	})
+	if got, want := g.AxisCount(), 1; got != want {
+		t.Fatalf("AxisCount(): got: %d, want: %d", got, want)
+	}
+	g.SetHatAxesEnabled(true)
+	if got, want := g.AxisCount(), 3; got != want {
+		t.Fatalf("AxisCount(): got: %d, want: %d", got, want)
+	}
+
+	if err := g.HandleEventForTesting(evAbs, absHat0X, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.HandleEventForTesting(evAbs, absHat0Y, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.Axis(1), 0.5; got != want {
+		t.Errorf("Axis(1): got: %f, want: %f", got, want)
+	}
+	if got, want := g.Axis(2), 0.0; got != want {
+		t.Errorf("Axis(2): got: %f, want: %f", got, want)
+	}
+
+	// The existing hat state is kept.
+	if got, want := g.Hat(0), hatRight; got != want {
+		t.Errorf("Hat(0): got: %d, want: %d", got, want)
+	}
+
+	g.SetHatAxesEnabled(false)
+	if got, want := g.Axis(1), 0.0; got != want {
+		t.Errorf("Axis(1): got: %f, want: %f", got, want)
+	}
+	if got, want := g.Hat(0), hatRight; got != want {
+		t.Errorf("Hat(0): got: %d, want: %d", got, want)
+	}
+}
+
+func TestOpenBackoff(t *testing.T) {
+	// A regular file can be opened, but ioctl for it always fails.
+	path := filepath.Join(t.TempDir(), "event0")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := gamepad.NewGamepadsForTesting()
+	now := time.Now()
+
+	// The first errors are returned.
+	for i := 0; i < 3; i++ {
+		if err := g.OpenGamepad(path, now); err == nil {
+			t.Fatalf("OpenGamepad() #%d: got: nil, want: an error", i)
+		}
+	}
+
+	// After that, the device is skipped until the retry time.
+	if err := g.OpenGamepad(path, now.Add(500*time.Millisecond)); err != nil {
+		t.Fatalf("OpenGamepad(): got: %v, want: nil", err)
+	}
+	if got, want := g.OpenFailureCount(path), 3; got != want {
+		t.Errorf("OpenFailureCount(): got: %d, want: %d", got, want)
+	}
+
+	// The device is retried later, and the error is not returned any more.
+	now = now.Add(time.Second)
+	if err := g.OpenGamepad(path, now); err != nil {
+		t.Fatalf("OpenGamepad(): got: %v, want: nil", err)
+	}
+	if got, want := g.OpenFailureCount(path), 4; got != want {
+		t.Errorf("OpenFailureCount(): got: %d, want: %d", got, want)
+	}
+
+	// The interval is doubled.
+	if err := g.OpenGamepad(path, now.Add(time.Second)); err != nil {
+		t.Fatalf("OpenGamepad(): got: %v, want: nil", err)
+	}
+	if got, want := g.OpenFailureCount(path), 4; got != want {
+		t.Errorf("OpenFailureCount(): got: %d, want: %d", got, want)
+	}
+	if err := g.OpenGamepad(path, now.Add(2*time.Second)); err != nil {
+		t.Fatalf("OpenGamepad(): got: %v, want: nil", err)
+	}
+	if got, want := g.OpenFailureCount(path), 5; got != want {
+		t.Errorf("OpenFailureCount(): got: %d, want: %d", got, want)
+	}
+}
+
+func TestGuessDeviceKind(t *testing.T) {
+	cases := []struct {
+		Name string
+		Keys []int
+		Kind gamepad.DeviceKind
+	}{
+		{
+			Name: "gamepad",
+			Keys: []int{0x130, 0x131, 0x133, 0x134, 0x13a, 0x13b},
+			Kind: gamepad.DeviceKindGamepad,
+		},
+		{
+			Name: "joystick",
+			Keys: []int{0x120, 0x121},
+			Kind: gamepad.DeviceKindGamepad,
+		},
+		{
+			Name: "d-pad only",
+			Keys: []int{0x220, 0x221, 0x222, 0x223},
+			Kind: gamepad.DeviceKindGamepad,
+		},
+		{
+			// BTN_LEFT, BTN_TOOL_FINGER, BTN_TOUCH, BTN_TOOL_DOUBLETAP
+			Name: "touchpad",
+			Keys: []int{0x110, 0x145, 0x14a, 0x14d},
+			Kind: gamepad.DeviceKindTouchpad,
+		},
+		{
+			// BTN_TOOL_PEN, BTN_TOUCH, BTN_STYLUS
+			Name: "tablet",
+			Keys: []int{0x140, 0x14a, 0x14b},
+			Kind: gamepad.DeviceKindTablet,
+		},
+		{
+			Name: "no buttons",
+			Keys: nil,
+			Kind: gamepad.DeviceKindUnknown,
+		},
+	}
+	for _, c := range cases {
+		if got := gamepad.GuessDeviceKindForTesting(c.Keys); got != c.Kind {
+			t.Errorf("%s: got: %d, want: %d", c.Name, got, c.Kind)
+		}
+	}
+
+	// A touchpad is rejected unless non-gamepad devices are allowed.
+	touchpadKeys := []int{0x110, 0x145, 0x14a, 0x14d}
+	g := gamepad.NewGamepadsForTesting()
+	if g.IsDeviceAccepted([]int{evKey, evAbs}, touchpadKeys) {
+		t.Errorf("IsDeviceAccepted() for a touchpad: got: true, want: false")
+	}
+	g.SetNonGamepadDevicesAllowed(true)
+	if !g.IsDeviceAccepted([]int{evKey, evAbs}, touchpadKeys) {
+		t.Errorf("IsDeviceAccepted() for a touchpad with non-gamepad devices allowed: got: false, want: true")
+	}
+}
+
+func TestAxisResponseCurve(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	})
+	g.SetAxisResponseCurve(0, gamepad.QuadraticResponseCurve)
+
+	cases := []struct {
+		Value int32
+		Want  float64
+	}{
+		{Value: 0, Want: 0},
+		{Value: 100, Want: 1},
+		{Value: -100, Want: -1},
+		{Value: 50, Want: 0.25},
+		{Value: -50, Want: -0.25},
+	}
+	for _, c := range cases {
+		if err := g.HandleEventForTesting(evAbs, absX, c.Value); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.Axis(0); got != c.Want {
+			t.Errorf("Axis(0) with %d: got: %f, want: %f", c.Value, got, c.Want)
+		}
+	}
+
+	g.SetAxisResponseCurve(0, nil)
+	if got, want := g.Axis(0), -0.5; got != want {
+		t.Errorf("Axis(0): got: %f, want: %f", got, want)
+	}
+}
+
+func TestDisabledGamepad(t *testing.T) {
+	const hatLeft = 8
+
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{btnA},
+		Abs:  []int{absX, absHat0X, absHat0Y},
+		AbsInfo: map[int][2]int32{
+			absX: {-1, 1},
+		},
+	})
+
+	g.SetEnabled(false)
+	for _, e := range []struct {
+		Type  uint16
+		Code  uint16
+		Value int32
+	}{
+		{Type: evKey, Code: btnA, Value: 1},
+		{Type: evAbs, Code: absX, Value: 1},
+		{Type: evAbs, Code: absHat0X, Value: -1},
+	} {
+		if err := g.HandleEventForTesting(e.Type, e.Code, e.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := g.Button(0); got {
+		t.Errorf("Button(0): got: %t, want: false", got)
+	}
+	if got := g.Axis(0); got != 0 {
+		t.Errorf("Axis(0): got: %f, want: 0", got)
+	}
+	if got := g.Hat(0); got != 0 {
+		t.Errorf("Hat(0): got: %d, want: 0", got)
+	}
+
+	// The events consumed while the gamepad is disabled are reflected after the gamepad is enabled.
+	g.SetEnabled(true)
+	if got := g.Button(0); !got {
+		t.Errorf("Button(0): got: %t, want: true", got)
+	}
+	if got, want := g.Axis(0), 1.0; got != want {
+		t.Errorf("Axis(0): got: %f, want: %f", got, want)
+	}
+	if got, want := g.Hat(0), hatLeft; got != want {
+		t.Errorf("Hat(0): got: %d, want: %d", got, want)
+	}
+}
+
+func TestMultipleDirectories(t *testing.T) {
+	dir0 := t.TempDir()
+	dir1 := t.TempDir()
+
+	g := newGamepads(t, dir0, dir1)
+
+	// Regular files are not valid devices, but opening them is tried for each directory.
+	path0 := filepath.Join(dir0, "event0")
+	path1 := filepath.Join(dir1, "event1")
+	for _, path := range []string{path0, path1} {
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Update(); err == nil {
+		t.Errorf("Update(): got: nil, want: an error")
+	}
+	for _, path := range []string{path0, path1} {
+		if got := g.OpenFailureCount(path); got == 0 {
+			t.Errorf("OpenFailureCount(%q): got: 0, want: > 0", path)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	g := newGamepads(t, dir)
+
+	var errs []error
+	g.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+
+	// Regular files are not valid devices. Each of them should be reported to the handler.
+	for _, name := range []string{"event0", "event1"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Update(); err != nil {
+		t.Errorf("Update(): got: %v, want: nil", err)
+	}
+	if got, want := len(errs), 2; got != want {
+		t.Errorf("the number of handled errors: got: %d, want: %d", got, want)
+	}
+
+	// Without a handler, the first error is returned from Update.
+	g.SetErrorHandler(nil)
+	if err := os.WriteFile(filepath.Join(dir, "event2"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Update(); err == nil {
+		t.Errorf("Update(): got: nil, want: an error")
+	}
+}
+
+func TestErrorHandlerWithReadError(t *testing.T) {
+	g := newGamepads(t, t.TempDir())
+
+	// Reading a directory always fails with EISDIR.
+	dir, err := os.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	r, w := newPipe(t)
+
+	device := &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+	}
+	g.AddGamepad(device, int(dir.Fd()))
+	gp := g.AddGamepad(device, r)
+
+	writeEvent(t, w, evKey, btnSouth, 1)
+
+	var errs []error
+	g.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	if err := g.Update(); err != nil {
+		t.Errorf("Update(): got: %v, want: nil", err)
+	}
+	if got, want := len(errs), 1; got != want {
+		t.Errorf("the number of handled errors: got: %d, want: %d", got, want)
+	}
+	if !gp.Button(0) {
+		t.Errorf("Button(0): got: false, want: true")
+	}
+}
+
+func TestShortRead(t *testing.T) {
+	g := gamepad.NewGamepadsForTesting()
+
+	r, w := newPipe(t)
+
+	gp := g.AddGamepad(&gamepad.DeviceForTesting{
+		Keys: []int{btnSouth, btnEast},
+	}, r)
+
+	var buf []byte
+	buf = append(buf, gamepad.EncodeInputEventForTesting(0, evKey, btnSouth, 1)...)
+	buf = append(buf, gamepad.EncodeInputEventForTesting(0, evKey, btnEast, 1)...)
+
+	// Write one complete event and a part of the next event.
+	half := len(buf) * 3 / 4
+	if _, err := unix.Write(w, buf[:half]); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if !gp.Button(0) {
+		t.Errorf("Button(0): got: false, want: true")
+	}
+	if gp.Button(1) {
+		t.Errorf("Button(1) before the rest is read: got: true, want: false")
+	}
+
+	if _, err := unix.Write(w, buf[half:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if !gp.Button(1) {
+		t.Errorf("Button(1) after the rest is read: got: false, want: true")
+	}
+}
+
+func TestButtonOnlyDevice(t *testing.T) {
+	g := gamepad.NewGamepadsForTesting()
+	if !g.IsDeviceAccepted([]int{evKey}, []int{btnSouth, btnEast}) {
+		t.Errorf("a device with only gamepad buttons must be accepted")
+	}
+	if g.IsDeviceAccepted([]int{evKey}, []int{keyA}) {
+		t.Errorf("a keyboard must not be accepted")
+	}
+	g.SetNonGamepadDevicesAllowed(true)
+	if g.IsDeviceAccepted([]int{evKey}, []int{keyA}) {
+		t.Errorf("a keyboard must not be accepted even when non-gamepad devices are allowed")
+	}
+	if !g.IsDeviceAccepted([]int{evKey, evAbs}, []int{keyA}) {
+		t.Errorf("a non-gamepad device with axes must be accepted when non-gamepad devices are allowed")
+	}
+
+	// The device without EV_ABS is registered through the same path as the other devices.
+	r, _ := newPipe(t)
+
+	const path = "/dev/input/event0"
+	gs := gamepad.NewGamepadsForTesting()
+	gp := openDevice(t, gs, path, &gamepad.DeviceForTesting{
+		EventTypes: []int{evKey},
+		Keys:       []int{btnSouth, btnEast},
+	}, r)
+
+	if got, want := gp.AxisCount(), 0; got != want {
+		t.Errorf("AxisCount(): got: %d, want: %d", got, want)
+	}
+	if got, want := gp.HatCount(), 0; got != want {
+		t.Errorf("HatCount(): got: %d, want: %d", got, want)
+	}
+	if got, want := gp.ButtonCount(), 2; got != want {
+		t.Errorf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+	if err := gp.HandleEventForTesting(evKey, btnEast, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !gp.Button(1) {
+		t.Errorf("Button(1): got: false, want: true")
+	}
+}
+
+func TestTouchpadNotRegistered(t *testing.T) {
+	r, _ := newPipe(t)
+
+	const path = "/dev/input/event0"
+	gs := gamepad.NewGamepadsForTesting()
+	gs.SetDevice(path, &gamepad.DeviceForTesting{
+		EventTypes: []int{evKey, evAbs},
+		// BTN_LEFT, BTN_TOOL_FINGER, BTN_TOUCH, BTN_TOOL_DOUBLETAP
+		Keys: []int{0x110, 0x145, 0x14a, 0x14d},
+		Abs:  []int{absX, absY},
+	}, r)
+	if err := gs.OpenGamepad(path, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(gs.Gamepads()), 0; got != want {
+		t.Errorf("len(Gamepads()): got: %d, want: %d", got, want)
+	}
+	if got := gs.OpenFailureCount(path); got != 0 {
+		t.Errorf("OpenFailureCount(%q): got: %d, want: 0", path, got)
+	}
+
+	// The looser behavior registers the touchpad.
+	gs.SetNonGamepadDevicesAllowed(true)
+	if err := gs.OpenGamepad(path, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(gs.Gamepads()), 1; got != want {
+		t.Fatalf("len(Gamepads()) with non-gamepad devices allowed: got: %d, want: %d", got, want)
+	}
+	gp := gs.Gamepads()[0]
+	defer gp.DisconnectForTesting()
+	if got, want := gp.DeviceKind(), gamepad.DeviceKindTouchpad; got != want {
+		t.Errorf("DeviceKind(): got: %d, want: %d", got, want)
+	}
+}
+
+func TestVibrationGain(t *testing.T) {
+	// The device doesn't support FF_GAIN, then the gain is applied in software.
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{})
+
+	for _, c := range []struct {
+		Gain   float64
+		Strong uint16
+		Weak   uint16
+	}{
+		{Gain: 1, Strong: 0xffff, Weak: 0x7fff},
+		{Gain: 0.5, Strong: 0x7fff, Weak: 0x3fff},
+		{Gain: 0, Strong: 0, Weak: 0},
+		{Gain: 2, Strong: 0xffff, Weak: 0x7fff},
+	} {
+		g.SetVibrationGain(c.Gain)
+		strong, weak := g.RumbleMagnitudesForTesting(1, 0.5)
+		if strong != c.Strong || weak != c.Weak {
+			t.Errorf("gain: %v: got: (%#x, %#x), want: (%#x, %#x)", c.Gain, strong, weak, c.Strong, c.Weak)
+		}
+	}
+}
+
+func TestAppendHats(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absHat0X, absHat0Y, absHat1X, absHat1Y},
+		AbsInfo: map[int][2]int32{
+			absHat0X: {-1, 1},
+			absHat0Y: {-1, 1},
+			absHat1X: {-1, 1},
+			absHat1Y: {-1, 1},
+		},
+	})
+	if got, want := g.HatCount(), 2; got != want {
+		t.Fatalf("HatCount(): got: %d, want: %d", got, want)
+	}
+
+	for _, e := range []struct {
+		Code  uint16
+		Value int32
+	}{
+		// The first hat is right-up.
+		{Code: absHat0X, Value: 1},
+		{Code: absHat0Y, Value: -1},
+		// The second hat is left-down.
+		{Code: absHat1X, Value: -1},
+		{Code: absHat1Y, Value: 1},
+	} {
+		if err := g.HandleEventForTesting(evAbs, e.Code, e.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := g.AppendHats(nil)
+	want := []int{1 | 2, 8 | 4}
+	if len(got) != len(want) {
+		t.Fatalf("AppendHats(): got: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AppendHats()[%d]: got: %d, want: %d", i, got[i], want[i])
+		}
+		if h := g.Hat(i); h != want[i] {
+			t.Errorf("Hat(%d): got: %d, want: %d", i, h, want[i])
+		}
+	}
+	if h := g.Hat(2); h != 0 {
+		t.Errorf("Hat(2): got: %d, want: 0", h)
+	}
+}
+
+func TestSDLMapping(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Name:    "Foo Pad",
+		BusType: 0x03,
+		Vendor:  0x045e,
+		Product: 0x028e,
+		Version: 0x0114,
+		Keys:    []int{btnSouth, btnEast},
+		Abs:     []int{absX, absY},
+		AbsInfo: map[int][2]int32{
+			absX: {-32768, 32767},
+			absY: {-32768, 32767},
+		},
+	})
+
+	// The GUID consists of 32 hex characters in little endian: the bus type, the vendor, the product and the version.
+	if got, want := g.SDLID(), "030000005e0400008e02000014010000"; got != want {
+		t.Errorf("SDLID(): got: %s, want: %s", got, want)
+	}
+
+	got, ok := g.SDLMapping()
+	if !ok {
+		t.Fatalf("SDLMapping(): got: false, want: true")
+	}
+	if want := "030000005e0400008e02000014010000,Foo Pad,a:b0,b:b1,leftx:a0,lefty:a1,platform:Linux,"; got != want {
+		t.Errorf("SDLMapping(): got: %s, want: %s", got, want)
+	}
+
+	// A device without vendor and product IDs uses its name.
+	g = gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Name:    "Foo",
+		BusType: 0x03,
+	})
+	if got, want := g.SDLID(), "03000000466f6f000000000000000000"; got != want {
+		t.Errorf("SDLID(): got: %s, want: %s", got, want)
+	}
+}
+
+func TestAxisEventsCoalesced(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	})
+	g.SetAxisEventsCoalesced(true)
+
+	for _, v := range []int32{10, 50, -100} {
+		if err := g.HandleEventForTesting(evAbs, absX, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := g.Axis(0), 0.0; got != want {
+		t.Errorf("Axis(0) before flushing: got: %v, want: %v", got, want)
+	}
+	g.FlushAbsEventsForTesting()
+	if got, want := g.Axis(0), -1.0; got != want {
+		t.Errorf("Axis(0) after flushing: got: %v, want: %v", got, want)
+	}
+
+	// Disabling the coalescing applies the pending events.
+	if err := g.HandleEventForTesting(evAbs, absX, 100); err != nil {
+		t.Fatal(err)
+	}
+	g.SetAxisEventsCoalesced(false)
+	if got, want := g.Axis(0), 1.0; got != want {
+		t.Errorf("Axis(0) after disabling the coalescing: got: %v, want: %v", got, want)
+	}
+}
+
+func BenchmarkAxisEventsBurst(b *testing.B) {
+	for _, coalesced := range []bool{false, true} {
+		name := "default"
+		if coalesced {
+			name = "coalesced"
+		}
+		b.Run(name, func(b *testing.B) {
+			g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+				Abs: []int{absX},
+				AbsInfo: map[int][2]int32{
+					absX: {-32768, 32767},
+				},
+			})
+			g.SetAxisEventsCoalesced(coalesced)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// A burst of events for the same axis in one update.
+				for j := int32(0); j < 64; j++ {
+					if err := g.HandleEventForTesting(evAbs, absX, j*512); err != nil {
+						b.Fatal(err)
+					}
+				}
+				g.FlushAbsEventsForTesting()
+			}
+		})
+	}
+}
+
+func TestAxisNavigator(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX, absY},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+			absY: {-100, 100},
+		},
+	})
+	n := &gamepad.AxisNavigator{
+		HorizontalAxis: 0,
+		VerticalAxis:   1,
+		Threshold:      0.5,
+		InitialDelay:   300 * time.Millisecond,
+		RepeatInterval: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	if got := n.Update(g, start); got != gamepad.DirectionNone {
+		t.Errorf("Update() at the neutral position: got: %v, want: %v", got, gamepad.DirectionNone)
+	}
+
+	// Hold the stick down.
+	if err := g.HandleEventForTesting(evAbs, absY, 80); err != nil {
+		t.Fatal(err)
+	}
+	var events []time.Duration
+	for d := time.Duration(0); d <= 600*time.Millisecond; d += 10 * time.Millisecond {
+		switch got := n.Update(g, start.Add(d)); got {
+		case gamepad.DirectionDown:
+			events = append(events, d)
+		case gamepad.DirectionNone:
+		default:
+			t.Fatalf("Update() at %v: got: %v, want: %v", d, got, gamepad.DirectionDown)
+		}
+	}
+	want := []time.Duration{0, 300 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond, 600 * time.Millisecond}
+	if len(events) != len(want) {
+		t.Fatalf("events: got: %v, want: %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("events[%d]: got: %v, want: %v", i, events[i], want[i])
+		}
+	}
+
+	// Releasing the stick resets the repeat.
+	if err := g.HandleEventForTesting(evAbs, absY, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Update(g, start.Add(700*time.Millisecond)); got != gamepad.DirectionNone {
+		t.Errorf("Update() after releasing: got: %v, want: %v", got, gamepad.DirectionNone)
+	}
+	if err := g.HandleEventForTesting(evAbs, absX, -80); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Update(g, start.Add(710*time.Millisecond)); got != gamepad.DirectionLeft {
+		t.Errorf("Update() after pushing left: got: %v, want: %v", got, gamepad.DirectionLeft)
+	}
+}
+
+func TestAxisNavigatorZeroValue(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX, absY},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+			absY: {-100, 100},
+		},
+	})
+	n := &gamepad.AxisNavigator{
+		VerticalAxis: 1,
+	}
+
+	// A centered stick doesn't navigate even though Threshold is 0.
+	start := time.Now()
+	for d := time.Duration(0); d <= 100*time.Millisecond; d += 10 * time.Millisecond {
+		if got := n.Update(g, start.Add(d)); got != gamepad.DirectionNone {
+			t.Fatalf("Update() at %v: got: %v, want: %v", d, got, gamepad.DirectionNone)
+		}
+	}
+
+	// The default threshold is 0.5, and the axis value must exceed it.
+	if err := g.HandleEventForTesting(evAbs, absX, 50); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Update(g, start.Add(110*time.Millisecond)); got != gamepad.DirectionNone {
+		t.Errorf("Update() at the threshold: got: %v, want: %v", got, gamepad.DirectionNone)
+	}
+	if err := g.HandleEventForTesting(evAbs, absX, 51); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Update(g, start.Add(120*time.Millisecond)); got != gamepad.DirectionRight {
+		t.Errorf("Update() beyond the threshold: got: %v, want: %v", got, gamepad.DirectionRight)
+	}
+}
+
+func TestPartialInotifyEvent(t *testing.T) {
+	dir := t.TempDir()
+
+	g := newGamepads(t, dir)
+
+	// A regular file is not a valid device, and opening it is recorded as a failure.
+	path := filepath.Join(dir, "event0")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// struct inotify_event with a name padded with nulls.
+	name := []byte("event0\x00\x00")
+	wd := g.WatchDescriptor(dir)
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(wd))
+	buf = binary.LittleEndian.AppendUint32(buf, unix.IN_CREATE)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name)))
+	buf = append(buf, name...)
+
+	// Neither a part of the header nor a part of the name should cause a panic.
+	for _, i := range []int{10, 8} {
+		g.HandleInotifyEvents(buf[:i])
+		if got := g.OpenFailureCount(path); got != 0 {
+			t.Errorf("OpenFailureCount(%q) with %d bytes: got: %d, want: 0", path, i, got)
+		}
+		buf = buf[i:]
+	}
+	g.HandleInotifyEvents(buf)
+	if got, want := g.OpenFailureCount(path), 1; got != want {
+		t.Errorf("OpenFailureCount(%q): got: %d, want: %d", path, got, want)
+	}
+}
+
+func TestInotifyMovedDevice(t *testing.T) {
+	for _, tc := range []struct {
+		Name      string
+		WatchMask uint32
+		Want      int
+	}{
+		{Name: "default", WatchMask: 0, Want: 1},
+		{Name: "without IN_MOVED_TO", WatchMask: unix.IN_CREATE | unix.IN_ATTRIB | unix.IN_DELETE, Want: 0},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			tmpDir := t.TempDir()
+
+			g := gamepad.NewGamepadsForTesting()
+			g.SetDirNames([]string{dir})
+			g.SetWatchMask(tc.WatchMask)
+			if err := g.Init(); err != nil {
+				t.Fatal(err)
+			}
+			// The failures to open the file are reported to the handler.
+			g.SetErrorHandler(func(err error) {})
+			defer func() {
+				if err := g.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			// A regular file is not a valid device, and opening it is recorded as a failure.
+			tmpPath := filepath.Join(tmpDir, "event0")
+			if err := os.WriteFile(tmpPath, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "event0")
+			if err := os.Rename(tmpPath, path); err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Update(); err != nil {
+				t.Fatal(err)
+			}
+			if got := g.OpenFailureCount(path); got != tc.Want {
+				t.Errorf("OpenFailureCount(%q) after moving in: got: %d, want: %d", path, got, tc.Want)
+			}
+
+			// Moving the file out is treated like a deletion.
+			if err := os.Rename(path, tmpPath); err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Update(); err != nil {
+				t.Fatal(err)
+			}
+			if got := g.OpenFailureCount(path); got != 0 {
+				t.Errorf("OpenFailureCount(%q) after moving out: got: %d, want: 0", path, got)
+			}
+		})
+	}
+}
+
+func TestAxisCalibration(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {0, 1000},
+		},
+	})
+	if err := g.HandleEventForTesting(evAbs, absX, 750); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.Axis(0), 0.5; got != want {
+		t.Errorf("Axis(0): got: %v, want: %v", got, want)
+	}
+
+	// The axis value is updated without new events.
+	if err := g.SetAxisCalibration(0, 500, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.Axis(0), 0.0; got != want {
+		t.Errorf("Axis(0) after the calibration: got: %v, want: %v", got, want)
+	}
+	if min, max, _ := g.AxisRange(0); min != 500 || max != 1000 {
+		t.Errorf("AxisRange(0): got: (%d, %d), want: (500, 1000)", min, max)
+	}
+
+	if err := g.SetAxisCalibration(0, 1000, 1000); err == nil {
+		t.Errorf("SetAxisCalibration(0, 1000, 1000): got: nil, want: an error")
+	}
+	if min, max, _ := g.AxisRange(0); min != 500 || max != 1000 {
+		t.Errorf("AxisRange(0) after an invalid calibration: got: (%d, %d), want: (500, 1000)", min, max)
+	}
+}
+
+func TestButtonKind(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		// BTN_SOUTH, BTN_EAST, BTN_NORTH, BTN_WEST, BTN_TL, BTN_TR, BTN_TL2, BTN_TR2,
+		// BTN_SELECT, BTN_START, BTN_MODE, BTN_THUMBL, BTN_THUMBR, BTN_DPAD_UP and BTN_TRIGGER_HAPPY1.
+		Keys: []int{0x130, 0x131, 0x133, 0x134, 0x136, 0x137, 0x138, 0x139, 0x13a, 0x13b, 0x13c, 0x13d, 0x13e, 0x220, 0x2c0},
+	})
+
+	want := []gamepad.ButtonKind{
+		gamepad.ButtonKindFace,
+		gamepad.ButtonKindFace,
+		gamepad.ButtonKindFace,
+		gamepad.ButtonKindFace,
+		gamepad.ButtonKindShoulder,
+		gamepad.ButtonKindShoulder,
+		gamepad.ButtonKindTrigger,
+		gamepad.ButtonKindTrigger,
+		gamepad.ButtonKindSystem,
+		gamepad.ButtonKindSystem,
+		gamepad.ButtonKindSystem,
+		gamepad.ButtonKindThumb,
+		gamepad.ButtonKindThumb,
+		gamepad.ButtonKindDPad,
+		gamepad.ButtonKindUnknown,
+	}
+	if got := g.ButtonCount(); got != len(want) {
+		t.Fatalf("ButtonCount(): got: %d, want: %d", got, len(want))
+	}
+	for i, k := range want {
+		code, _ := g.ButtonRawCode(i)
+		if got := g.ButtonKind(i); got != k {
+			t.Errorf("ButtonKind(%d) for %#x: got: %d, want: %d", i, code, got, k)
+		}
+	}
+	if got := g.ButtonKind(len(want)); got != gamepad.ButtonKindUnknown {
+		t.Errorf("ButtonKind(%d): got: %d, want: %d", len(want), got, gamepad.ButtonKindUnknown)
+	}
+}
+
+func TestSystemButtons(t *testing.T) {
+	// The device doesn't have BTN_START.
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{btnSouth, btnSelect, btnMode},
+	})
+	if err := g.HandleEventForTesting(evKey, btnMode, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !g.GuidePressed() {
+		t.Errorf("GuidePressed(): got: false, want: true")
+	}
+	if g.SelectPressed() {
+		t.Errorf("SelectPressed(): got: true, want: false")
+	}
+	if g.StartPressed() {
+		t.Errorf("StartPressed(): got: true, want: false")
+	}
+
+	g.SetEnabled(false)
+	if g.GuidePressed() {
+		t.Errorf("GuidePressed() for a disabled gamepad: got: true, want: false")
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	g := newGamepads(t, t.TempDir())
+
+	r, w := newPipe(t)
+
+	gp := g.AddGamepad(&gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		Abs:  []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	}, r)
+	gp.SetEventFilter([]int{evAbs})
+	gp.StartRecording()
+
+	write := func(typ, code uint16, value int32) {
+		t.Helper()
+		writeEvent(t, w, typ, code, value)
+	}
+
+	write(evKey, btnSouth, 1)
+	write(evAbs, absX, 100)
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if gp.Button(0) {
+		t.Errorf("Button(0): got: true, want: false")
+	}
+	if got, want := gp.Axis(0), 1.0; got != want {
+		t.Errorf("Axis(0): got: %v, want: %v", got, want)
+	}
+	recorded := gp.StopRecording()
+	if got, want := len(recorded), 1; got != want {
+		t.Fatalf("len(StopRecording()): got: %d, want: %d", got, want)
+	}
+	if got, want := recorded[0].Type, uint16(evAbs); got != want {
+		t.Errorf("StopRecording()[0].Type: got: %d, want: %d", got, want)
+	}
+
+	gp.SetEventFilter([]int{evKey, evAbs})
+	write(evKey, btnSouth, 1)
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if !gp.Button(0) {
+		t.Errorf("Button(0): got: false, want: true")
+	}
+}
+
+func TestRecordingAndPlayback(t *testing.T) {
+	g := newGamepads(t, t.TempDir())
+
+	r, w := newPipe(t)
+
+	device := &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		Abs:  []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	}
+	live := g.AddGamepad(device, r)
+	// A gamepad without a device file only plays back events.
+	replayed := g.AddGamepad(device, 0)
+
+	type state struct {
+		Axis   float64
+		Button bool
+	}
+	frames := [][][3]int32{
+		{{evKey, btnSouth, 1}, {evAbs, absX, 50}},
+		{},
+		{{evAbs, absX, -100}},
+		{{evKey, btnSouth, 0}},
+	}
+
+	live.StartRecording()
+	var want []state
+	for _, events := range frames {
+		for _, e := range events {
+			writeEvent(t, w, uint16(e[0]), uint16(e[1]), e[2])
+		}
+		if err := g.Update(); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, state{Axis: live.Axis(0), Button: live.Button(0)})
+	}
+	recorded := live.StopRecording()
+
+	// The recorded events can be serialized.
+	bs, err := json.Marshal(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []gamepad.RecordedEvent
+	if err := json.Unmarshal(bs, &events); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed.StartPlayback(events)
+	for i := range frames {
+		if !replayed.IsPlayingBack() {
+			t.Fatalf("IsPlayingBack() at frame %d: got: false, want: true", i)
+		}
+		if err := g.Update(); err != nil {
+			t.Fatal(err)
+		}
+		if got := (state{Axis: replayed.Axis(0), Button: replayed.Button(0)}); got != want[i] {
+			t.Errorf("frame %d: got: %+v, want: %+v", i, got, want[i])
+		}
+	}
+	if replayed.IsPlayingBack() {
+		t.Errorf("IsPlayingBack() after the playback: got: true, want: false")
+	}
+}
+
+func TestPlaybackWithInvalidCodes(t *testing.T) {
+	g := newGamepads(t, t.TempDir())
+
+	gp := g.AddGamepad(&gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		Abs:  []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	}, 0)
+	gp.SetAxisEventsCoalesced(true)
+
+	gp.StartPlayback([]gamepad.RecordedEvent{
+		{Type: evAbs, Code: 64, Value: 1},
+		{Type: evAbs, Code: 0xffff, Value: 1},
+		{Type: evKey, Code: 0xffff, Value: 1},
+		{Type: evKey, Code: btnSouth, Value: 1},
+		{Type: evAbs, Code: absX, Value: 100},
+	})
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if !gp.Button(0) {
+		t.Errorf("Button(0): got: false, want: true")
+	}
+	if got, want := gp.Axis(0), 1.0; got != want {
+		t.Errorf("Axis(0): got: %v, want: %v", got, want)
+	}
+}
+
+func TestAxisInverted(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX, absY},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+			absY: {-100, 100},
+		},
+	})
+	g.SetAxisInverted(1, true)
+
+	for _, v := range []int32{-100, -50, 0, 50, 100} {
+		if err := g.HandleEventForTesting(evAbs, absX, v); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.HandleEventForTesting(evAbs, absY, v); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := g.Axis(1), -g.Axis(0); got != want {
+			t.Errorf("Axis(1) with %d: got: %v, want: %v", v, got, want)
+		}
+	}
+
+	g.SetAxisInverted(1, false)
+	if got, want := g.Axis(1), 1.0; got != want {
+		t.Errorf("Axis(1): got: %v, want: %v", got, want)
+	}
+}
+
+func TestSetMapping(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Name:    "Mapping Test Pad",
+		BusType: 0x03,
+		Vendor:  0x1234,
+		Product: 0x5678,
+		Version: 0x0001,
+		Keys:    []int{btnSouth, btnEast},
+	})
+	if err := g.HandleEventForTesting(evKey, btnSouth, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swap A and B.
+	if err := g.SetMapping("00000000000000000000000000000000,Swapped,a:b1,b:b0,platform:Linux,"); err != nil {
+		t.Fatal(err)
+	}
+	if g.IsStandardButtonPressed(gamepaddb.StandardButtonRightBottom) {
+		t.Errorf("IsStandardButtonPressed(RightBottom): got: true, want: false")
+	}
+	if !g.IsStandardButtonPressed(gamepaddb.StandardButtonRightRight) {
+		t.Errorf("IsStandardButtonPressed(RightRight): got: false, want: true")
+	}
+
+	// Invalid mappings don't change the current mapping.
+	for _, m := range []string{
+		"",
+		"00000000000000000000000000000000,Invalid,a:x0,platform:Linux,",
+		"00000000000000000000000000000000,Windows,a:b0,b:b1,platform:Windows,",
+	} {
+		if err := g.SetMapping(m); err == nil {
+			t.Errorf("SetMapping(%q): got: nil, want: an error", m)
+		}
+	}
+	if !g.IsStandardButtonPressed(gamepaddb.StandardButtonRightRight) {
+		t.Errorf("IsStandardButtonPressed(RightRight) after invalid mappings: got: false, want: true")
+	}
+}
+
+func TestVibrationRemaining(t *testing.T) {
+	clock := gamepad.NewFakeClockForTesting()
+	gps := gamepad.NewGamepadsForTesting()
+	gps.SetClock(clock)
+	g := gps.AddGamepad(&gamepad.DeviceForTesting{}, 0)
+	if got := g.VibrationRemaining(); got != 0 {
+		t.Errorf("VibrationRemaining() before vibrating: got: %v, want: 0", got)
+	}
+
+	const duration = 100 * time.Millisecond
+	g.StartVibrationTimerForTesting(duration)
+	if got, want := g.VibrationRemaining(), duration; got != want {
+		t.Errorf("VibrationRemaining(): got: %v, want: %v", got, want)
+	}
+
+	clock.Advance(duration / 4)
+	if got, want := g.VibrationRemaining(), duration*3/4; got != want {
+		t.Errorf("VibrationRemaining() after a quarter: got: %v, want: %v", got, want)
+	}
+
+	clock.Advance(duration)
+	if got := g.VibrationRemaining(); got != 0 {
+		t.Errorf("VibrationRemaining() after the duration: got: %v, want: 0", got)
+	}
+}
+
+func TestVibrationAutoStop(t *testing.T) {
+	const effectID = 3
+
+	// The events written to the device can be read from the pipe.
+	r, w := newPipe(t)
+
+	clock := gamepad.NewFakeClockForTesting()
+	gps := gamepad.NewGamepadsForTesting()
+	gps.SetClock(clock)
+	g := gps.AddGamepad(&gamepad.DeviceForTesting{}, w)
+	g.SetFFEffectIDForTesting(effectID)
+
+	const duration = 100 * time.Millisecond
+	g.StartVibrationTimerForTesting(duration)
+
+	buf := make([]byte, 256)
+	clock.Advance(duration - time.Nanosecond)
+	if n, err := unix.Read(r, buf); err != unix.EAGAIN {
+		t.Fatalf("Read before the duration: got: %d bytes, %v, want: EAGAIN", n, err)
+	}
+
+	clock.Advance(time.Nanosecond)
+	n, err := unix.Read(r, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf[:n], gamepad.EncodeInputEventForTesting(0, evFF, effectID, 0); string(got) != string(want) {
+		t.Errorf("the written event: got: %v, want: %v", got, want)
+	}
+	if got := g.VibrationRemaining(); got != 0 {
+		t.Errorf("VibrationRemaining(): got: %v, want: 0", got)
+	}
+}
+
+func TestVibrationTimerCanceled(t *testing.T) {
+	// The events written to the device can be read from the other end of the socket.
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	clock := gamepad.NewFakeClockForTesting()
+	gps := gamepad.NewGamepadsForTesting()
+	gps.SetClock(clock)
+	const path = "/dev/input/event0"
+	g := openDevice(t, gps, path, &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		FF:   []int{ffRumble},
+	}, fds[0])
+
+	readEvents := func() string {
+		t.Helper()
+		var events []byte
+		buf := make([]byte, 256)
+		for {
+			n, err := unix.Read(fds[1], buf)
+			if err == unix.EAGAIN {
+				return string(events)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, buf[:n]...)
+		}
+	}
+	// The emulated device assigns 0 to the uploaded effect.
+	stop := string(gamepad.EncodeInputEventForTesting(0, evFF, 0, 0))
+
+	const duration = 100 * time.Millisecond
+
+	// A new vibration cancels the timer of the previous vibration.
+	g.Vibrate(duration, 1, 1)
+	clock.Advance(duration / 2)
+	g.Vibrate(duration, 1, 1)
+	_ = readEvents()
+	clock.Advance(duration / 2)
+	if got := readEvents(); got != "" {
+		t.Errorf("the written events at the end of the first vibration: got: %v, want: none", []byte(got))
+	}
+	if got, want := g.VibrationRemaining(), duration/2; got != want {
+		t.Errorf("VibrationRemaining(): got: %v, want: %v", got, want)
+	}
+	clock.Advance(duration / 2)
+	if got := readEvents(); got != stop {
+		t.Errorf("the written events at the end of the second vibration: got: %v, want: %v", []byte(got), []byte(stop))
+	}
+
+	// Stopping the vibration cancels the timer.
+	g.Vibrate(duration, 1, 1)
+	g.Vibrate(0, 0, 0)
+	if got := readEvents(); !strings.HasSuffix(got, stop) {
+		t.Errorf("the written events by stopping: got: %v, want: ending with %v", []byte(got), []byte(stop))
+	}
+	if got := g.VibrationRemaining(); got != 0 {
+		t.Errorf("VibrationRemaining() after stopping: got: %v, want: 0", got)
+	}
+	clock.Advance(duration)
+	if got := readEvents(); got != "" {
+		t.Errorf("the written events after stopping: got: %v, want: none", []byte(got))
+	}
+}
+
+func TestMaxGamepads(t *testing.T) {
+	dir := t.TempDir()
+	g := newGamepads(t, dir)
+	var errs []error
+	g.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	g.SetMaxGamepads(2)
+
+	var gps []*gamepad.Gamepad
+	for i, path := range []string{"/dev/input/event1", "/dev/input/event2"} {
+		if g.IsFull() {
+			t.Errorf("IsFull() with %d gamepads: got: true, want: false", i)
+		}
+		r, _ := newPipe(t)
+		gps = append(gps, openDevice(t, g, path, &gamepad.DeviceForTesting{
+			Keys: []int{btnSouth},
+		}, r))
+	}
+	if !g.IsFull() {
+		t.Errorf("IsFull() with 2 gamepads: got: false, want: true")
+	}
+
+	// A device connected to the full gamepads is refused, and the refusal is reported.
+	r, _ := newPipe(t)
+	path := filepath.Join(dir, "event0")
+	g.SetDevice(path, &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+	}, r)
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(g.Gamepads()), 2; got != want {
+		t.Errorf("len(Gamepads()) after a refused connection: got: %d, want: %d", got, want)
+	}
+	if got, want := len(errs), 1; got != want {
+		t.Fatalf("len(errs): got: %d, want: %d", got, want)
+	}
+	if !strings.Contains(errs[0].Error(), path) {
+		t.Errorf("errs[0]: got: %q, want: an error for %s", errs[0], path)
+	}
+	if got := g.OpenFailureCount(path); got != 0 {
+		t.Errorf("OpenFailureCount(%q): got: %d, want: 0", path, got)
+	}
+
+	// A disconnected gamepad makes room for another one.
+	gps[0].DisconnectForTesting()
+	if g.IsFull() {
+		t.Errorf("IsFull() after a disconnection: got: true, want: false")
+	}
+
+	gps[1].DisconnectForTesting()
+}
+
+func TestDPadHat(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{btnSouth, btnDPadUp, btnDPadDown, btnDPadLeft, btnDPadRight},
+	})
+
+	// The hat is not synthesized by default, so that the d-pad is not reported twice.
+	if err := g.HandleEventForTesting(evKey, btnDPadUp, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.HatCount(), 0; got != want {
+		t.Errorf("HatCount() by default: got: %d, want: %d", got, want)
+	}
+	if got, want := g.Hat(0), 0; got != want {
+		t.Errorf("Hat(0) by default: got: %d, want: %d", got, want)
+	}
+	if err := g.HandleEventForTesting(evKey, btnDPadUp, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	g.SetDPadAsHat(true)
+	if got, want := g.HatCount(), 1; got != want {
+		t.Fatalf("HatCount(): got: %d, want: %d", got, want)
+	}
+	// The d-pad buttons are still buttons.
+	if got, want := g.ButtonCount(), 5; got != want {
+		t.Errorf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+
+	for _, c := range []struct {
+		Code  uint16
+		Value int32
+		Hat   int
+	}{
+		{Code: btnDPadUp, Value: 1, Hat: 1},
+		{Code: btnDPadRight, Value: 1, Hat: 1 | 2},
+		{Code: btnDPadUp, Value: 0, Hat: 2},
+		{Code: btnDPadDown, Value: 1, Hat: 2 | 4},
+		{Code: btnDPadRight, Value: 0, Hat: 4},
+		{Code: btnDPadLeft, Value: 1, Hat: 4 | 8},
+		{Code: btnDPadDown, Value: 0, Hat: 8},
+		{Code: btnDPadLeft, Value: 0, Hat: 0},
+	} {
+		if err := g.HandleEventForTesting(evKey, c.Code, c.Value); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.Hat(0); got != c.Hat {
+			t.Errorf("Hat(0) after %#x = %d: got: %d, want: %d", c.Code, c.Value, got, c.Hat)
+		}
+	}
+
+	// The synthesized hat works as virtual axes too.
+	g.SetHatAxesEnabled(true)
+	if err := g.HandleEventForTesting(evKey, btnDPadLeft, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.HandleEventForTesting(evKey, btnDPadDown, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.Axis(0), -1.0; got != want {
+		t.Errorf("Axis(0): got: %v, want: %v", got, want)
+	}
+	if got, want := g.Axis(1), 1.0; got != want {
+		t.Errorf("Axis(1): got: %v, want: %v", got, want)
+	}
+}
+
+func TestHapticTestWithoutForceFeedback(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{})
+	if g.HapticTest() {
+		t.Errorf("HapticTest(): got: true, want: false")
+	}
+	if got := g.VibrationRemaining(); got != 0 {
+		t.Errorf("VibrationRemaining(): got: %v, want: 0", got)
+	}
+}
+
+func TestAxisValueByte(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	})
+
+	for _, tc := range []struct {
+		Value int32
+		Want  uint8
+	}{
+		{Value: -100, Want: 0},
+		{Value: 0, Want: 128},
+		{Value: 100, Want: 255},
+	} {
+		if err := g.HandleEventForTesting(evAbs, absX, tc.Value); err != nil {
+			t.Fatal(err)
+		}
+		if got := g.AxisValueByte(0); got != tc.Want {
+			t.Errorf("AxisValueByte(0) with %d: got: %d, want: %d", tc.Value, got, tc.Want)
+		}
+	}
+}
+
+func TestPlayerLEDWithoutLEDs(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{})
+	g.SetPlayerLED(1)
+	if got, want := g.PlayerLED(), -1; got != want {
+		t.Errorf("PlayerLED(): got: %d, want: %d", got, want)
+	}
+}
+
+func TestStickAxisValue(t *testing.T) {
+	t.Run("standard", func(t *testing.T) {
+		g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+			Abs: []int{absX, absY, absZ, absRX, absRY, absRZ},
+			AbsInfo: map[int][2]int32{
+				absX:  {-100, 100},
+				absY:  {-100, 100},
+				absZ:  {0, 255},
+				absRX: {-100, 100},
+				absRY: {-100, 100},
+				absRZ: {0, 255},
+			},
+		})
+		for _, e := range []struct {
+			Code  uint16
+			Value int32
+		}{
+			{absX, -100},
+			{absY, 100},
+			{absZ, 255},
+			{absRX, 100},
+			{absRY, -100},
+			{absRZ, 0},
+		} {
+			if err := g.HandleEventForTesting(evAbs, e.Code, e.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tc := range []struct {
+			Axis gamepad.StickAxis
+			Want float64
+		}{
+			{gamepad.StickAxisLeftX, -1},
+			{gamepad.StickAxisLeftY, 1},
+			{gamepad.StickAxisRightX, 1},
+			{gamepad.StickAxisRightY, -1},
+			{gamepad.StickAxisLeftTrigger, 1},
+			{gamepad.StickAxisRightTrigger, 0},
+		} {
+			if got := g.StickAxisValue(tc.Axis); got != tc.Want {
+				t.Errorf("StickAxisValue(%d): got: %v, want: %v", tc.Axis, got, tc.Want)
+			}
+		}
+	})
+
+	t.Run("right stick on z", func(t *testing.T) {
+		g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+			Abs: []int{absX, absY, absZ, absRZ, absGas, absBrake},
+			AbsInfo: map[int][2]int32{
+				absX:     {-100, 100},
+				absY:     {-100, 100},
+				absZ:     {-100, 100},
+				absRZ:    {-100, 100},
+				absGas:   {0, 1023},
+				absBrake: {0, 1023},
+			},
+		})
+		for _, e := range []struct {
+			Code  uint16
+			Value int32
+		}{
+			{absZ, 100},
+			{absRZ, -100},
+			{absGas, 1023},
+			{absBrake, 0},
+		} {
+			if err := g.HandleEventForTesting(evAbs, e.Code, e.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tc := range []struct {
+			Axis gamepad.StickAxis
+			Want float64
+		}{
+			{gamepad.StickAxisRightX, 1},
+			{gamepad.StickAxisRightY, -1},
+			{gamepad.StickAxisLeftTrigger, 0},
+			{gamepad.StickAxisRightTrigger, 1},
+		} {
+			if got := g.StickAxisValue(tc.Axis); got != tc.Want {
+				t.Errorf("StickAxisValue(%d): got: %v, want: %v", tc.Axis, got, tc.Want)
+			}
+		}
+	})
+
+	t.Run("no axes", func(t *testing.T) {
+		g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{})
+		if got := g.StickAxisValue(gamepad.StickAxisLeftX); got != 0 {
+			t.Errorf("StickAxisValue(StickAxisLeftX): got: %v, want: 0", got)
+		}
+	})
+}
+
+func TestEventQueue(t *testing.T) {
+	newGamepad := func() *gamepad.Gamepad {
+		return gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+			Keys: []int{btnA, btnB, btnX},
+		})
+	}
+	pollAll := func(g *gamepad.Gamepad) []gamepad.Event {
+		var events []gamepad.Event
+		for {
+			e, ok := g.PollEvent()
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		}
+	}
+	press := func(t *testing.T, g *gamepad.Gamepad, code uint16, value int32) {
+		if err := g.HandleEventForTesting(evKey, code, value); err != nil {
+			t.Fatal(err)
+		}
+		g.DetectEventsForTesting()
+	}
+
+	t.Run("normal", func(t *testing.T) {
+		g := newGamepad()
+		g.EnableEventQueue(8, gamepad.EventQueueDropOldest)
+		press(t, g, btnA, 1)
+		press(t, g, btnA, 0)
+		press(t, g, btnB, 1)
+
+		got := pollAll(g)
+		want := []gamepad.Event{
+			{Type: gamepad.EventTypeButton, Index: 0, Value: 1},
+			{Type: gamepad.EventTypeButton, Index: 0, Value: 0},
+			{Type: gamepad.EventTypeButton, Index: 1, Value: 1},
+		}
+		if len(got) != len(want) {
+			t.Fatalf("events: got: %v, want: %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("events[%d]: got: %v, want: %v", i, got[i], want[i])
+			}
+		}
+	})
+
+	for _, tc := range []struct {
+		Name   string
+		Policy gamepad.EventQueueOverflowPolicy
+		Want   []int
+	}{
+		{Name: "drop oldest", Policy: gamepad.EventQueueDropOldest, Want: []int{1, 2}},
+		{Name: "drop newest", Policy: gamepad.EventQueueDropNewest, Want: []int{0, 1}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			g := newGamepad()
+			g.EnableEventQueue(2, tc.Policy)
+			press(t, g, btnA, 1)
+			press(t, g, btnB, 1)
+			press(t, g, btnX, 1)
+
+			got := pollAll(g)
+			if len(got) != len(tc.Want) {
+				t.Fatalf("events: got: %v, want indices: %v", got, tc.Want)
+			}
+			for i, index := range tc.Want {
+				if got[i].Index != index {
+					t.Errorf("events[%d].Index: got: %d, want: %d", i, got[i].Index, index)
+				}
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		g := newGamepad()
+		press(t, g, btnA, 1)
+		if e, ok := g.PollEvent(); ok {
+			t.Errorf("PollEvent(): got: %v, want: no events", e)
+		}
+	})
+}
+
+func TestSupportedEffects(t *testing.T) {
+	for _, tc := range []struct {
+		FF   []int
+		Want gamepad.Effects
+	}{
+		{FF: nil, Want: 0},
+		{FF: []int{ffRumble}, Want: gamepad.EffectRumble},
+		{FF: []int{ffRumble, ffGain}, Want: gamepad.EffectRumble},
+		{FF: []int{ffPeriodic, ffConstant, ffRamp}, Want: gamepad.EffectPeriodic | gamepad.EffectConstant | gamepad.EffectRamp},
+	} {
+		g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+			FF: tc.FF,
+		})
+		if got := g.SupportedEffects(); got != tc.Want {
+			t.Errorf("SupportedEffects() with %v: got: %b, want: %b", tc.FF, got, tc.Want)
+		}
+	}
+}
+
+func TestUnreadableAxis(t *testing.T) {
+	device := &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		Abs:  []int{absX, absY, absRX},
+		AbsInfo: map[int][2]int32{
+			absX:  {-100, 100},
+			absRX: {-100, 100},
+		},
+		UnreadableAbs: []int{absY},
+	}
+	g := gamepad.NewGamepadForTesting(device)
+	if got, want := g.AxisCount(), 2; got != want {
+		t.Fatalf("AxisCount(): got: %d, want: %d", got, want)
+	}
+
+	// The events for the skipped axis are ignored.
+	for _, e := range []struct {
+		Code  uint16
+		Value int32
+	}{
+		{absX, 100},
+		{absY, 100},
+		{absRX, -100},
+	} {
+		if err := g.HandleEventForTesting(evAbs, e.Code, e.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := g.Axis(0), 1.0; got != want {
+		t.Errorf("Axis(0): got: %v, want: %v", got, want)
+	}
+	if got, want := g.Axis(1), -1.0; got != want {
+		t.Errorf("Axis(1): got: %v, want: %v", got, want)
+	}
+
+	// The skipped axis is reported when the device is connected.
+	dir := t.TempDir()
+	gs := newGamepads(t, dir)
+	var errs []error
+	gs.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+
+	r, _ := newPipe(t)
+
+	path := filepath.Join(dir, "event0")
+	gs.SetDevice(path, device, r)
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(gs.Gamepads()), 1; got != want {
+		t.Fatalf("len(Gamepads()): got: %d, want: %d", got, want)
+	}
+	if got, want := gs.Gamepads()[0].AxisCount(), 2; got != want {
+		t.Errorf("AxisCount(): got: %d, want: %d", got, want)
+	}
+	if got, want := len(errs), 1; got != want {
+		t.Fatalf("len(errs): got: %d, want: %d", got, want)
+	}
+	if !errors.Is(errs[0], unix.EIO) {
+		t.Errorf("errs[0]: got: %v, want: %v", errs[0], unix.EIO)
+	}
+}
+
+func TestInputState(t *testing.T) {
+	newDevice := func() *gamepad.DeviceForTesting {
+		return &gamepad.DeviceForTesting{
+			Keys: []int{btnA},
+			Abs:  []int{absX, absY},
+			AbsInfo: map[int][2]int32{
+				absX: {-100, 100},
+				absY: {-100, 100},
+			},
+		}
+	}
+
+	gps := gamepad.NewGamepadsForTesting()
+	g0 := gps.AddGamepad(newDevice(), 0)
+	g1 := gps.AddGamepad(newDevice(), 0)
+	g2 := gps.AddGamepad(newDevice(), 0)
+
+	if err := g1.HandleEventForTesting(evAbs, absX, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := g2.HandleEventForTesting(evKey, btnA, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The player index of the other gamepads doesn't change by a disconnection.
+	gps.RemoveGamepad(g0)
+
+	s := gps.InputState()
+
+	if s.IsGamepadConnected(0) {
+		t.Errorf("IsGamepadConnected(0): got: true, want: false")
+	}
+	if got := s.GamepadAxis(0, gamepaddb.StandardAxisLeftStickHorizontal); got != 0 {
+		t.Errorf("GamepadAxis(0, StandardAxisLeftStickHorizontal): got: %v, want: 0", got)
+	}
+	if got, want := s.GamepadAxis(1, gamepaddb.StandardAxisLeftStickHorizontal), 1.0; got != want {
+		t.Errorf("GamepadAxis(1, StandardAxisLeftStickHorizontal): got: %v, want: %v", got, want)
+	}
+	if got := s.GamepadAxis(2, gamepaddb.StandardAxisLeftStickHorizontal); got != 0 {
+		t.Errorf("GamepadAxis(2, StandardAxisLeftStickHorizontal): got: %v, want: 0", got)
+	}
+	if s.GamepadButton(1, gamepaddb.StandardButtonRightBottom) {
+		t.Errorf("GamepadButton(1, StandardButtonRightBottom): got: true, want: false")
+	}
+	if !s.GamepadButton(2, gamepaddb.StandardButtonRightBottom) {
+		t.Errorf("GamepadButton(2, StandardButtonRightBottom): got: false, want: true")
+	}
+	if s.IsGamepadConnected(3) {
+		t.Errorf("IsGamepadConnected(3): got: true, want: false")
+	}
+
+	// The snapshot is not affected by the later inputs.
+	if err := g1.HandleEventForTesting(evAbs, absX, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GamepadAxis(1, gamepaddb.StandardAxisLeftStickHorizontal), 1.0; got != want {
+		t.Errorf("GamepadAxis(1, StandardAxisLeftStickHorizontal) after an event: got: %v, want: %v", got, want)
+	}
+}
+
+func TestMaxHats(t *testing.T) {
+	var abs []int
+	absInfo := map[int][2]int32{}
+	for code := absHat0X; code <= absHat3Y; code++ {
+		abs = append(abs, code)
+		absInfo[code] = [2]int32{-1, 1}
+	}
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys:    []int{btnDPadUp, btnDPadDown},
+		Abs:     abs,
+		AbsInfo: absInfo,
+	})
+
+	g.SetDPadAsHat(true)
+
+	// The four ABS_HAT hats and the hat synthesized from the d-pad buttons.
+	if got, want := g.HatCount(), 5; got != want {
+		t.Fatalf("HatCount(): got: %d, want: %d", got, want)
+	}
+
+	for code := absHat0X; code <= absHat3Y; code++ {
+		if err := g.HandleEventForTesting(evAbs, uint16(code), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.HandleEventForTesting(evKey, btnDPadUp, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		hatUp    = 1
+		hatRight = 2
+		hatDown  = 4
+	)
+	for i := 0; i < 4; i++ {
+		if got, want := g.Hat(i), hatRight|hatDown; got != want {
+			t.Errorf("Hat(%d): got: %d, want: %d", i, got, want)
+		}
+	}
+	if got, want := g.Hat(4), hatUp; got != want {
+		t.Errorf("Hat(4): got: %d, want: %d", got, want)
+	}
+	if got, want := g.Hat(5), 0; got != want {
+		t.Errorf("Hat(5): got: %d, want: %d", got, want)
+	}
+}
+
+func TestDebugString(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Name:    "Test Pad",
+		BusType: 0x03,
+		Vendor:  0x1234,
+		Product: 0x5678,
+		Version: 0x0114,
+		Keys:    []int{btnA, btnB, btnX},
+		Abs:     []int{absX, absY, absHat0X, absHat0Y},
+		FF:      []int{ffRumble},
+	})
+	got := g.DebugString()
+	for _, want := range []string{
+		`"Test Pad"`,
+		g.SDLID(),
+		"vendor: 0x1234",
+		"product: 0x5678",
+		"version: 0x0114",
+		"axes: 2",
+		"buttons: 3",
+		"hats: 1",
+		"force feedback: true",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("DebugString(): got: %q, want to include: %q", got, want)
+		}
+	}
+}
+
+func TestButtonMask(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Keys: []int{btnA, btnB, btnX, btnY},
+	})
+	if got := g.ButtonMask(); got != 0 {
+		t.Errorf("ButtonMask(): got: %b, want: 0", got)
+	}
+
+	for _, code := range []uint16{btnA, btnX, btnY} {
+		if err := g.HandleEventForTesting(evKey, code, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := g.ButtonMask(), uint64(0b1101); got != want {
+		t.Errorf("ButtonMask(): got: %b, want: %b", got, want)
+	}
+
+	g.SetEnabled(false)
+	if got := g.ButtonMask(); got != 0 {
+		t.Errorf("ButtonMask() with the gamepad disabled: got: %b, want: 0", got)
+	}
+}
+
+func TestAxisResolution(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX, absY},
+		AbsInfo: map[int][2]int32{
+			absX: {0, 4095},
+			absY: {0, 4095},
+		},
+		AbsResolution: map[int]int32{
+			absX: 40,
+		},
+	})
+	for _, tc := range []struct {
+		Axis int
+		Want int32
+	}{
+		{Axis: 0, Want: 40},
+		{Axis: 1, Want: 0},
+		{Axis: 2, Want: 0},
+		{Axis: -1, Want: 0},
+	} {
+		if got := g.AxisResolution(tc.Axis); got != tc.Want {
+			t.Errorf("AxisResolution(%d): got: %d, want: %d", tc.Axis, got, tc.Want)
+		}
+	}
+}
+
+func TestSetMappingSharedBySDLID(t *testing.T) {
+	device := &gamepad.DeviceForTesting{
+		Name:    "Shared Mapping Test Pad",
+		BusType: 0x03,
+		Vendor:  0x1234,
+		Product: 0x5679,
+		Version: 0x0001,
+		Keys:    []int{btnSouth, btnEast},
+	}
+	g0 := gamepad.NewGamepadForTesting(device)
+	g1 := gamepad.NewGamepadForTesting(device)
+	if g0.SDLID() != g1.SDLID() {
+		t.Fatalf("SDLID(): got: %q and %q, want: the same IDs", g0.SDLID(), g1.SDLID())
+	}
+	for _, g := range []*gamepad.Gamepad{g0, g1} {
+		if err := g.HandleEventForTesting(evKey, btnSouth, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The mapping set for one gamepad applies to the other gamepad with the same SDL ID.
+	if err := g0.SetMapping("00000000000000000000000000000000,Swapped,a:b1,b:b0,platform:Linux,"); err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range []*gamepad.Gamepad{g0, g1} {
+		if !g.IsStandardButtonPressed(gamepaddb.StandardButtonRightRight) {
+			t.Errorf("gamepad %d: IsStandardButtonPressed(RightRight): got: false, want: true", i)
+		}
+	}
+
+	// The mapping is kept for a gamepad connected later.
+	g2 := gamepad.NewGamepadForTesting(device)
+	if err := g2.HandleEventForTesting(evKey, btnSouth, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !g2.IsStandardButtonPressed(gamepaddb.StandardButtonRightRight) {
+		t.Errorf("a new gamepad: IsStandardButtonPressed(RightRight): got: false, want: true")
+	}
+}
+
+func TestReconnectAtSamePath(t *testing.T) {
+	g := newGamepads(t, t.TempDir())
+
+	r, w := newPipe(t)
+
+	const path = "/dev/input/event0"
+	g.SetDevice(path, &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth},
+		Abs:  []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	}, r)
+	if err := g.OpenGamepad(path, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(g.Gamepads()), 1; got != want {
+		t.Fatalf("len(Gamepads()): got: %d, want: %d", got, want)
+	}
+	old := g.Gamepads()[0]
+
+	for _, e := range [][3]int32{{evKey, btnSouth, 1}, {evAbs, absX, 100}} {
+		writeEvent(t, w, uint16(e[0]), uint16(e[1]), e[2])
+	}
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if !old.Button(0) {
+		t.Fatalf("Button(0) before the disconnection: got: false, want: true")
+	}
+
+	// The device is reconnected at the same path with different capabilities.
+	old.DisconnectForTesting()
+	gp := openDevice(t, g, path, &gamepad.DeviceForTesting{
+		Keys: []int{btnSouth, btnEast},
+		Abs:  []int{absX},
+		AbsInfo: map[int][2]int32{
+			absX: {-100, 100},
+		},
+	}, r)
+
+	if gp == old {
+		t.Fatalf("Gamepads()[0] after the reconnection: got: the stale gamepad, want: a new gamepad")
+	}
+	if got, want := gp.ButtonCount(), 2; got != want {
+		t.Errorf("ButtonCount(): got: %d, want: %d", got, want)
+	}
+	for i := 0; i < gp.ButtonCount(); i++ {
+		if gp.Button(i) {
+			t.Errorf("Button(%d): got: true, want: false", i)
+		}
+	}
+	if got, want := gp.Axis(0), 0.0; got != want {
+		t.Errorf("Axis(0): got: %v, want: %v", got, want)
+	}
+}
+
+func TestIoctlError(t *testing.T) {
+	r, _ := newPipe(t)
+
+	// A pipe is not an input device, and the ioctl must fail.
+	if err := gamepad.IoctlGetIDForTesting(r); !errors.Is(err, unix.ENOTTY) {
+		t.Errorf("IoctlGetIDForTesting(): got: %v, want: %v", err, unix.ENOTTY)
+	}
+}
+
+func TestRawAxisValue(t *testing.T) {
+	g := gamepad.NewGamepadForTesting(&gamepad.DeviceForTesting{
+		Abs: []int{absX, absRX},
+		AbsInfo: map[int][2]int32{
+			absX:  {-32768, 32767},
+			absRX: {0, 1023},
+		},
+	})
+	if err := g.HandleEventForTesting(evAbs, absX, -12345); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.HandleEventForTesting(evAbs, absRX, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range []struct {
+		Raw int32
+		Min int32
+		Max int32
+	}{
+		{Raw: -12345, Min: -32768, Max: 32767},
+		{Raw: 1000, Min: 0, Max: 1023},
+	} {
+		raw, ok := g.RawAxisValue(i)
+		if !ok || raw != c.Raw {
+			t.Errorf("RawAxisValue(%d): got: (%d, %t), want: (%d, true)", i, raw, ok, c.Raw)
+		}
+		min, max, ok := g.AxisRange(i)
+		if !ok || min != c.Min || max != c.Max {
+			t.Errorf("AxisRange(%d): got: (%d, %d, %t), want: (%d, %d, true)", i, min, max, ok, c.Min, c.Max)
+		}
+	}
+	for _, axis := range []int{-1, 2} {
+		if _, ok := g.RawAxisValue(axis); ok {
+			t.Errorf("RawAxisValue(%d): got: true, want: false", axis)
+		}
+	}
+
+	// A disabled gamepad doesn't report the raw values.
+	g.SetEnabled(false)
+	if raw, ok := g.RawAxisValue(0); ok {
+		t.Errorf("RawAxisValue(0) while disabled: got: (%d, true), want: (0, false)", raw)
+	}
+	g.SetEnabled(true)
+	if raw, ok := g.RawAxisValue(0); !ok || raw != -12345 {
+		t.Errorf("RawAxisValue(0) after enabled: got: (%d, %t), want: (-12345, true)", raw, ok)
+	}
+}
@@ -107,6 +107,7 @@ func (n *nativeGamepadsXbox) deviceCallback(callbackToken _GameInputCallbackToke
 		gp := gps.add("", "00000000000000000000000000000000")
 		gp.native = &nativeGamepadXbox{
 			gameInputDevice: device,
+			clock:           gps.getClock(),
 		}
 		return 0
 	}
@@ -125,6 +126,8 @@ type nativeGamepadXbox struct {
 
 	vib    bool
 	vibEnd time.Time
+
+	clock clock
 }
 
 func (n *nativeGamepadXbox) update(gamepads *gamepads) error {
@@ -142,7 +145,7 @@ func (n *nativeGamepadXbox) update(gamepads *gamepads) error {
 	}
 	n.state = state
 
-	if n.vib && time.Now().Sub(n.vibEnd) >= 0 {
+	if n.vib && n.clock.Now().Sub(n.vibEnd) >= 0 {
 		n.gameInputDevice.SetRumbleState(&_GameInputRumbleParams{
 			lowFrequency:  0,
 			highFrequency: 0,
@@ -255,7 +258,7 @@ func (n *nativeGamepadXbox) vibrate(duration time.Duration, strongMagnitude floa
 		return
 	}
 	n.vib = true
-	n.vibEnd = time.Now().Add(duration)
+	n.vibEnd = n.clock.Now().Add(duration)
 	n.gameInputDevice.SetRumbleState(&_GameInputRumbleParams{
 		lowFrequency:  float32(strongMagnitude),
 		highFrequency: float32(weakMagnitude),
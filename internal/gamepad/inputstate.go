@@ -0,0 +1,112 @@
+// Copyright 2022 The Ebiten Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gamepad
+
+import (
+	"github.com/hajimehoshi/ebiten/v2/internal/gamepaddb"
+)
+
+// InputState is an immutable snapshot of the standard layout inputs of all the gamepads.
+//
+// A player index is the index of the slot of a gamepad, which is same as the gamepad ID.
+// The slot is kept while the gamepad is connected, even when other gamepads are disconnected.
+type InputState struct {
+	players []playerState
+}
+
+type playerState struct {
+	connected     bool
+	axes          [gamepaddb.StandardAxisMax + 1]float64
+	buttonValues  [gamepaddb.StandardButtonMax + 1]float64
+	buttonPressed [gamepaddb.StandardButtonMax + 1]bool
+}
+
+// TakeInputState returns the current inputs of all the gamepads.
+//
+// TakeInputState is concurrent-safe.
+func TakeInputState() *InputState {
+	return theGamepads.inputState()
+}
+
+func (g *gamepads) inputState() *InputState {
+	g.m.Lock()
+	gps := make([]*Gamepad, len(g.gamepads))
+	copy(gps, g.gamepads)
+	g.m.Unlock()
+
+	s := &InputState{
+		players: make([]playerState, len(gps)),
+	}
+	for i, gp := range gps {
+		if gp == nil {
+			continue
+		}
+		p := &s.players[i]
+		p.connected = true
+		for axis := gamepaddb.StandardAxis(0); axis <= gamepaddb.StandardAxisMax; axis++ {
+			p.axes[axis] = gp.StandardAxisValue(axis)
+		}
+		for button := gamepaddb.StandardButton(0); button <= gamepaddb.StandardButtonMax; button++ {
+			p.buttonValues[button] = gp.StandardButtonValue(button)
+			p.buttonPressed[button] = gp.IsStandardButtonPressed(button)
+		}
+	}
+	return s
+}
+
+func (s *InputState) player(playerIndex int) *playerState {
+	if playerIndex < 0 || playerIndex >= len(s.players) {
+		return nil
+	}
+	if !s.players[playerIndex].connected {
+		return nil
+	}
+	return &s.players[playerIndex]
+}
+
+// IsGamepadConnected reports whether the gamepad for the player index was connected.
+func (s *InputState) IsGamepadConnected(playerIndex int) bool {
+	return s.player(playerIndex) != nil
+}
+
+// GamepadAxis returns the value of the standard axis of the gamepad for the player index.
+// GamepadAxis returns 0 if the gamepad was not connected.
+func (s *InputState) GamepadAxis(playerIndex int, axis gamepaddb.StandardAxis) float64 {
+	p := s.player(playerIndex)
+	if p == nil || axis < 0 || axis > gamepaddb.StandardAxisMax {
+		return 0
+	}
+	return p.axes[axis]
+}
+
+// GamepadButton reports whether the standard button of the gamepad for the player index was pressed.
+// GamepadButton returns false if the gamepad was not connected.
+func (s *InputState) GamepadButton(playerIndex int, button gamepaddb.StandardButton) bool {
+	p := s.player(playerIndex)
+	if p == nil || button < 0 || button > gamepaddb.StandardButtonMax {
+		return false
+	}
+	return p.buttonPressed[button]
+}
+
+// GamepadButtonValue returns the value of the standard button of the gamepad for the player index in [0, 1].
+// GamepadButtonValue returns 0 if the gamepad was not connected.
+func (s *InputState) GamepadButtonValue(playerIndex int, button gamepaddb.StandardButton) float64 {
+	p := s.player(playerIndex)
+	if p == nil || button < 0 || button > gamepaddb.StandardButtonMax {
+		return 0
+	}
+	return p.buttonValues[button]
+}
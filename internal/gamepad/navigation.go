@@ -0,0 +1,110 @@
+// Copyright 2022 The Ebiten Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gamepad
+
+import (
+	"math"
+	"time"
+)
+
+// Direction is a direction for menu navigation.
+type Direction int
+
+const (
+	DirectionNone Direction = iota
+	DirectionUp
+	DirectionDown
+	DirectionLeft
+	DirectionRight
+)
+
+// defaultNavigationThreshold is the threshold of AxisNavigator when its Threshold is not specified.
+const defaultNavigationThreshold = 0.5
+
+// AxisNavigator converts a pair of axes into directional events for menu navigation.
+// Like the keyboard auto-repeat, an event is emitted when an axis is pushed beyond the threshold,
+// and then repeated while the axis is held.
+type AxisNavigator struct {
+	// HorizontalAxis and VerticalAxis are the axis indices. Negative values are left and up respectively.
+	HorizontalAxis int
+	VerticalAxis   int
+
+	// Threshold is the absolute axis value in (0, 1] to emit events. An axis value must exceed Threshold.
+	// 0 or less means defaultNavigationThreshold.
+	Threshold float64
+
+	// InitialDelay is the duration from the first event to the first repeat.
+	InitialDelay time.Duration
+
+	// RepeatInterval is the interval of the repeats. 0 or less disables the repeats.
+	RepeatInterval time.Duration
+
+	direction Direction
+	nextTime  time.Time
+}
+
+// Update returns the direction to navigate at now, or DirectionNone if there is nothing to do.
+// Update should be called once every frame.
+func (a *AxisNavigator) Update(gamepad *Gamepad, now time.Time) Direction {
+	d := a.currentDirection(gamepad)
+	if d == DirectionNone {
+		a.direction = DirectionNone
+		return DirectionNone
+	}
+
+	if d != a.direction {
+		a.direction = d
+		a.nextTime = now.Add(a.InitialDelay)
+		return d
+	}
+
+	if a.RepeatInterval <= 0 || now.Before(a.nextTime) {
+		return DirectionNone
+	}
+	a.nextTime = a.nextTime.Add(a.RepeatInterval)
+	// Don't emit the missed repeats all at once after a long frame.
+	if a.nextTime.Before(now) {
+		a.nextTime = now.Add(a.RepeatInterval)
+	}
+	return d
+}
+
+func (a *AxisNavigator) currentDirection(gamepad *Gamepad) Direction {
+	x := gamepad.Axis(a.HorizontalAxis)
+	y := gamepad.Axis(a.VerticalAxis)
+
+	t := a.Threshold
+	if t <= 0 {
+		t = defaultNavigationThreshold
+	}
+
+	// The dominant axis wins so that a diagonal input doesn't alternate the directions.
+	if math.Abs(x) >= math.Abs(y) {
+		switch {
+		case x < -t:
+			return DirectionLeft
+		case x > t:
+			return DirectionRight
+		}
+		return DirectionNone
+	}
+	switch {
+	case y < -t:
+		return DirectionUp
+	case y > t:
+		return DirectionDown
+	}
+	return DirectionNone
+}
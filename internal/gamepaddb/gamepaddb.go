@@ -358,6 +358,106 @@ func toStandardGamepadAxis(str string) (StandardAxis, bool) {
 	}
 }
 
+func standardGamepadButtonName(button StandardButton) string {
+	switch button {
+	case StandardButtonRightBottom:
+		return "a"
+	case StandardButtonRightRight:
+		return "b"
+	case StandardButtonRightLeft:
+		return "x"
+	case StandardButtonRightTop:
+		return "y"
+	case StandardButtonCenterLeft:
+		return "back"
+	case StandardButtonCenterRight:
+		return "start"
+	case StandardButtonCenterCenter:
+		return "guide"
+	case StandardButtonFrontTopLeft:
+		return "leftshoulder"
+	case StandardButtonFrontTopRight:
+		return "rightshoulder"
+	case StandardButtonLeftStick:
+		return "leftstick"
+	case StandardButtonRightStick:
+		return "rightstick"
+	case StandardButtonLeftTop:
+		return "dpup"
+	case StandardButtonLeftRight:
+		return "dpright"
+	case StandardButtonLeftBottom:
+		return "dpdown"
+	case StandardButtonLeftLeft:
+		return "dpleft"
+	case StandardButtonFrontBottomLeft:
+		return "lefttrigger"
+	case StandardButtonFrontBottomRight:
+		return "righttrigger"
+	default:
+		return ""
+	}
+}
+
+func standardGamepadAxisName(axis StandardAxis) string {
+	switch axis {
+	case StandardAxisLeftStickHorizontal:
+		return "leftx"
+	case StandardAxisLeftStickVertical:
+		return "lefty"
+	case StandardAxisRightStickHorizontal:
+		return "rightx"
+	case StandardAxisRightStickVertical:
+		return "righty"
+	default:
+		return ""
+	}
+}
+
+func (p platform) sdlName() string {
+	switch p {
+	case platformWindows:
+		return "Windows"
+	case platformMacOS:
+		return "Mac OS X"
+	case platformUnix:
+		return "Linux"
+	case platformAndroid:
+		return "Android"
+	case platformIOS:
+		return "iOS"
+	default:
+		return ""
+	}
+}
+
+// FormatMapping formats a line of the SDL game controller DB for the current platform.
+// buttons and axes are the mapping elements like "b0", "a1" or "h0.4".
+func FormatMapping(id string, name string, buttons map[StandardButton]string, axes map[StandardAxis]string) string {
+	var b strings.Builder
+	b.WriteString(id)
+	b.WriteString(",")
+	// A comma is the separator and cannot be used in a name.
+	b.WriteString(strings.ReplaceAll(name, ",", " "))
+	b.WriteString(",")
+	for button := StandardButton(0); button <= StandardButtonMax; button++ {
+		e, ok := buttons[button]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%s,", standardGamepadButtonName(button), e)
+	}
+	for axis := StandardAxis(0); axis <= StandardAxisMax; axis++ {
+		e, ok := axes[axis]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%s,", standardGamepadAxisName(axis), e)
+	}
+	fmt.Fprintf(&b, "platform:%s,", currentPlatform.sdlName())
+	return b.String()
+}
+
 func buttonMappings(id string) map[StandardButton]*mapping {
 	if m, ok := gamepadButtonMappings[id]; ok {
 		return m
@@ -600,6 +700,33 @@ func Update(mappingData []byte) error {
 	return nil
 }
 
+// SetMapping sets a mapping for the given ID from a line in the same format as the game controller DB.
+// The ID in the line is ignored, and can be empty.
+//
+// SetMapping works atomically. If an error happens, nothing is updated.
+func SetMapping(id string, line string) error {
+	mappingsM.Lock()
+	defer mappingsM.Unlock()
+
+	// Replace the ID in the line so that an empty ID is not treated as an empty line.
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, ","); i >= 0 && !strings.HasPrefix(line, "#") {
+		line = id + line[i:]
+	}
+	lineID, name, buttons, axes, err := parseLine(line, currentPlatform)
+	if err != nil {
+		return err
+	}
+	if lineID == "" {
+		return fmt.Errorf("gamepaddb: the mapping is empty or not for the current platform: %q", line)
+	}
+
+	gamepadNames[id] = name
+	gamepadButtonMappings[id] = buttons
+	gamepadAxisMappings[id] = axes
+	return nil
+}
+
 func addAndroidDefaultMappings(id string) bool {
 	// See https://github.com/libsdl-org/SDL/blob/120c76c84bbce4c1bfed4e9eb74e10678bd83120/src/joystick/SDL_gamecontroller.c#L468-L568
 
@@ -65,3 +65,67 @@ func TestUpdate(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatMapping(t *testing.T) {
+	const id = "0300000000f00000f100000000000000"
+	line := gamepaddb.FormatMapping(id, "Foo, Bar", map[gamepaddb.StandardButton]string{
+		gamepaddb.StandardButtonRightBottom: "b0",
+		gamepaddb.StandardButtonLeftTop:     "h0.1",
+	}, map[gamepaddb.StandardAxis]string{
+		gamepaddb.StandardAxisLeftStickHorizontal: "a0",
+	})
+
+	if err := gamepaddb.Update([]byte(line)); err != nil {
+		t.Fatalf("Update(%q) should not return an error but returned %v", line, err)
+	}
+	if got, want := gamepaddb.Name(id), "Foo  Bar"; got != want {
+		t.Errorf("Name(): got: %q, want: %q", got, want)
+	}
+	for _, b := range []gamepaddb.StandardButton{gamepaddb.StandardButtonRightBottom, gamepaddb.StandardButtonLeftTop} {
+		if !gamepaddb.HasStandardButton(id, b) {
+			t.Errorf("HasStandardButton(%d): got: false, want: true", b)
+		}
+	}
+	if gamepaddb.HasStandardButton(id, gamepaddb.StandardButtonRightRight) {
+		t.Errorf("HasStandardButton(%d): got: true, want: false", gamepaddb.StandardButtonRightRight)
+	}
+	if !gamepaddb.HasStandardAxis(id, gamepaddb.StandardAxisLeftStickHorizontal) {
+		t.Errorf("HasStandardAxis(%d): got: false, want: true", gamepaddb.StandardAxisLeftStickHorizontal)
+	}
+}
+
+func TestSetMapping(t *testing.T) {
+	const (
+		id      = "0300000034120000785600000000000f"
+		otherID = "0300000034120000785600000000000e"
+	)
+
+	// The ID in the line is ignored, and can be empty.
+	for _, line := range []string{
+		otherID + ",Foo,a:b0,",
+		",Bar,a:b0,",
+	} {
+		if err := gamepaddb.SetMapping(id, line); err != nil {
+			t.Errorf("SetMapping(%q) should not return an error but returned %v", line, err)
+		}
+	}
+	if got, want := gamepaddb.Name(id), "Bar"; got != want {
+		t.Errorf("Name(): got: %q, want: %q", got, want)
+	}
+	if got, want := gamepaddb.Name(otherID), ""; got != want {
+		t.Errorf("Name() for the ID in the line: got: %q, want: %q", got, want)
+	}
+
+	for _, line := range []string{
+		"",
+		"# comment,Foo,a:b0,",
+		",Baz,a:x0,",
+	} {
+		if err := gamepaddb.SetMapping(id, line); err == nil {
+			t.Errorf("SetMapping(%q) should return an error but not", line)
+		}
+	}
+	if got, want := gamepaddb.Name(id), "Bar"; got != want {
+		t.Errorf("Name() after the errors: got: %q, want: %q", got, want)
+	}
+}